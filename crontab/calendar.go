@@ -0,0 +1,121 @@
+package crontab
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Calendar 是任务的排除日历，落在排除时段内的执行会被跳过，不会补执行。
+// 支持三种时段：
+//   - ExcludeRange：一段绝对时间，比如停服维护；
+//   - ExcludeDate：某一天，比如节假日；
+//   - ExcludeWeekly：每周固定的时段，比如每周二的维护窗口。
+//
+// 日期和每周时段按任务的时区计算。一个Calendar可以给多个任务使用，
+// 运行时也可以继续添加，所有方法都可以在任意goroutine中调用。
+type Calendar struct {
+	mu     sync.RWMutex
+	ranges []timeRange
+	dates  map[date]struct{}
+	weekly []weeklyWindow
+}
+
+type timeRange struct {
+	from, to time.Time
+}
+
+type date struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+type weeklyWindow struct {
+	day      time.Weekday
+	from, to time.Duration //相对当天0点，to可以超过24小时，表示跨到第二天
+}
+
+func NewCalendar() *Calendar {
+	return &Calendar{
+		dates: make(map[date]struct{}),
+	}
+}
+
+// WithCalendar 让任务跳过cal中的排除时段。
+// 日历不会持久化，恢复任务后需要重新设置。
+func WithCalendar(cal *Calendar) JobOption {
+	return func(e *Entry) {
+		e.cal = cal
+	}
+}
+
+// ExcludeRange 排除[from, to)这段时间。
+func (c *Calendar) ExcludeRange(from, to time.Time) error {
+	if !to.After(from) {
+		return fmt.Errorf("invalid range:%v-%v", from, to)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ranges = append(c.ranges, timeRange{from, to})
+	return nil
+}
+
+// ExcludeDate 排除某一整天。
+func (c *Calendar) ExcludeDate(year int, month time.Month, day int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dates[date{year, month, day}] = struct{}{}
+}
+
+// ExcludeWeekly 排除每周day的[from, to)时段，from、to是相对当天0点的时长。
+// to超过24小时表示跨到第二天，比如周六22:00到周日02:00为(time.Saturday, 22h, 26h)。
+func (c *Calendar) ExcludeWeekly(day time.Weekday, from, to time.Duration) error {
+	if from < 0 || to <= from || to-from > 7*24*time.Hour {
+		return fmt.Errorf("invalid weekly window:%v-%v", from, to)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.weekly = append(c.weekly, weeklyWindow{day, from, to})
+	return nil
+}
+
+// Excluded 判断t是否在排除时段内，日期和每周时段按t自身的时区计算。
+func (c *Calendar) Excluded(t time.Time) bool {
+	_, _, ok := c.window(t)
+	return ok
+}
+
+// window 返回包含t的排除时段[start, end)。
+func (c *Calendar) window(t time.Time) (start, end time.Time, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, r := range c.ranges {
+		if !t.Before(r.from) && t.Before(r.to) {
+			return r.from, r.to, true
+		}
+	}
+
+	y, m, d := t.Date()
+	if _, ok := c.dates[date{y, m, d}]; ok {
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()), true
+	}
+
+	for _, w := range c.weekly {
+		//时段可能是前几天开始的
+		for back := 0; back < 8; back++ {
+			day := time.Date(y, m, d-back, 0, 0, 0, 0, t.Location())
+			if day.Weekday() != w.day {
+				continue
+			}
+			//用纳秒构造，按墙上时间计算，不受夏令时影响
+			start = time.Date(y, m, d-back, 0, 0, 0, int(w.from), t.Location())
+			end = time.Date(y, m, d-back, 0, 0, 0, int(w.to), t.Location())
+			if !t.Before(start) && t.Before(end) {
+				return start, end, true
+			}
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
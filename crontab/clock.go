@@ -0,0 +1,279 @@
+package crontab
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 为Crontab提供时间。上层应用可能有自己的时间系统（比如GM调时间），
+// 实现该接口即可让Crontab跟随。
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer 对应time.Timer，由Clock创建。
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock 直接使用标准包的时间。
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time { return t.t.C }
+
+func (t *systemTimer) Stop() bool { return t.t.Stop() }
+
+func (t *systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// OffsetClock 在系统时间上加一个偏移量，偏移量可以在运行时修改。
+// 修改后，已创建的Timer会按新的时间重新计算到期时刻，无需重启Crontab。
+type OffsetClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+	timers map[*offsetTimer]struct{}
+}
+
+// NewOffsetClock 创建一个当前时间为now（unix秒）的时钟。
+func NewOffsetClock(now int64) *OffsetClock {
+	c := &OffsetClock{
+		timers: make(map[*offsetTimer]struct{}),
+	}
+	c.offset = time.Unix(now, 0).Sub(time.Now())
+	return c
+}
+
+func (c *OffsetClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.offset)
+}
+
+// SetNow 把时钟的当前时间调整为now（unix秒）。
+func (c *OffsetClock) SetNow(now int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = time.Unix(now, 0).Sub(time.Now())
+	c.rearm()
+}
+
+// Shift 把时钟向前（d>0）或向后（d<0）拨动d。
+func (c *OffsetClock) Shift(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+	c.rearm()
+}
+
+func (c *OffsetClock) NewTimer(d time.Duration) Timer {
+	t := &offsetTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+	t.Reset(d)
+	return t
+}
+
+// rearm 时间调整后，让所有Timer按新时间重新计时，调用者需持有锁。
+func (c *OffsetClock) rearm() {
+	now := time.Now().Add(c.offset)
+	for t := range c.timers {
+		t.t.Reset(t.deadline.Sub(now))
+	}
+}
+
+type offsetTimer struct {
+	clock    *OffsetClock
+	c        chan time.Time
+	t        *time.Timer
+	deadline time.Time //时钟时间下的到期时刻
+}
+
+func (t *offsetTimer) C() <-chan time.Time { return t.c }
+
+func (t *offsetTimer) fire() {
+	c := t.clock
+	c.mu.Lock()
+	if _, ok := c.timers[t]; !ok {
+		c.mu.Unlock()
+		return
+	}
+	now := time.Now().Add(c.offset)
+	if now.Before(t.deadline) {
+		//时钟被往回拨了，继续等
+		t.t.Reset(t.deadline.Sub(now))
+		c.mu.Unlock()
+		return
+	}
+	delete(c.timers, t)
+	c.mu.Unlock()
+
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *offsetTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	delete(c.timers, t)
+	if t.t != nil {
+		t.t.Stop()
+	}
+	return active
+}
+
+func (t *offsetTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	t.deadline = time.Now().Add(c.offset).Add(d)
+	c.timers[t] = struct{}{}
+	if t.t == nil {
+		t.t = time.AfterFunc(d, t.fire)
+	} else {
+		t.t.Reset(d)
+	}
+	return active
+}
+
+// FakeClock 用于测试，时间只会在调用Advance时前进。
+// Advance按到期顺序逐个触发Timer，并等到Timer的使用者处理完
+// （即对该Timer调用了Reset或Stop）才继续，所以任务的触发是同步、确定的。
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time),
+	}
+	t.Reset(d)
+	return t
+}
+
+// Advance 把时间推进d，期间到期的Timer依次触发。
+// 如果Timer的使用者不读取C，Advance会一直阻塞。
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		t := c.earliest(target)
+		if t == nil {
+			break
+		}
+		if t.deadline.After(c.now) {
+			c.now = t.deadline
+		}
+		now := c.now
+		delete(c.timers, t)
+		done := make(chan struct{})
+		t.done = done
+		c.mu.Unlock()
+
+		select {
+		case t.c <- now:
+			<-done
+		case <-done:
+		}
+
+		c.mu.Lock()
+	}
+	if target.After(c.now) {
+		c.now = target
+	}
+	c.mu.Unlock()
+}
+
+// Set 把时间直接调整到t，不触发任何Timer，用于模拟时间跳变。
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// earliest 返回到期时刻不晚于target的最早的Timer，调用者需持有锁。
+func (c *FakeClock) earliest(target time.Time) *fakeTimer {
+	var ret *fakeTimer
+	for t := range c.timers {
+		if t.deadline.After(target) {
+			continue
+		}
+		if ret == nil || t.deadline.Before(ret.deadline) {
+			ret = t
+		}
+	}
+	return ret
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+	done     chan struct{} //触发后等待使用者Reset或Stop
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// ack 通知Advance本次触发已处理完，调用者需持有锁。
+func (t *fakeTimer) ack() {
+	if t.done != nil {
+		close(t.done)
+		t.done = nil
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	delete(c.timers, t)
+	t.ack()
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	t.deadline = c.now.Add(d)
+	c.timers[t] = struct{}{}
+	t.ack()
+	return active
+}
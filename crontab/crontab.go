@@ -2,6 +2,7 @@ package crontab
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -9,8 +10,12 @@ import (
 type crontab struct {
 	entries map[uint64]*Entry
 	idmgr   uint64
+	loc     *time.Location
 
 	lastRunTime int64
+
+	store    JobStore
+	handlers map[string]func(...interface{})
 }
 
 func (c *crontab) remove(id uint64) {
@@ -48,29 +53,264 @@ func (c *crontab) addSchedule(id uint64,
 
 func (c *crontab) addScheduleByStr(id uint64, str string,
 	cmd func(...interface{}), args ...interface{}) (uint64, error) {
+	if !strings.HasPrefix(str, "@") {
+		strs, err := splitExpr(str)
+		if err != nil {
+			return 0, err
+		}
+		return c.addSchedule(id, strs[0], strs[1], strs[2], strs[3], strs[4], cmd, args...)
+	}
 
-	strs := strings.Split(str, " ")
+	e, err := parseSchedule(0, str, cmd, args...)
+	if err != nil {
+		return 0, err
+	}
+	e.id = c.genid(id)
+	c.entries[e.id] = e
+	return e.id, nil
+}
+
+func splitExpr(str string) ([]string, error) {
+	strs := strings.Fields(str)
 	if len(strs) != 5 {
-		return 0, fmt.Errorf("error input:%s", str)
+		return nil, fmt.Errorf("schedule string must have five components like * * * * *:%s", str)
+	}
+	return strs, nil
+}
+
+func (c *crontab) addJob(id uint64, str string, job Job, opts ...JobOption) (uint64, error) {
+	id, err := c.addScheduleByStr(id, str, nil)
+	if err != nil {
+		return 0, err
+	}
+	e := c.entries[id]
+	e.job = job
+	for _, opt := range opts {
+		opt(e)
+	}
+	return id, nil
+}
+
+func (c *crontab) addNamedJob(id uint64, name, str, handler string,
+	args ...interface{}) (uint64, error) {
+	cmd, ok := c.handlers[handler]
+	if !ok {
+		return 0, fmt.Errorf("handler not registered:%s", handler)
+	}
+
+	id, err := c.addScheduleByStr(id, str, cmd, args...)
+	if err != nil {
+		return 0, err
+	}
+	e := c.entries[id]
+	e.name = name
+	e.handler = handler
+	return id, nil
+}
+
+// restore 恢复持久化的任务，返回恢复后的id。已存在的同id持久化任务会被覆盖；
+// 如果id已经被不需要持久化的任务占用（比如重启后先添加的固定任务），则换一个新的id。
+func (c *crontab) restore(rec *JobRecord) (uint64, error) {
+	cmd, ok := c.handlers[rec.Handler]
+	if !ok {
+		return 0, fmt.Errorf("handler not registered:%s", rec.Handler)
+	}
+	e, err := parseSchedule(rec.ID, rec.Expr, cmd, rec.Args...)
+	if err != nil {
+		return 0, err
+	}
+	if rec.Location != "" {
+		if e.loc, err = time.LoadLocation(rec.Location); err != nil {
+			return 0, err
+		}
+	}
+	e.name = rec.Name
+	e.handler = rec.Handler
+	e.misfire = rec.Misfire
+	e.misfireMax = rec.MisfireMax
+	e.paused = rec.Paused
+	if rec.LastRun > 0 {
+		e.last = time.Unix(rec.LastRun, 0)
+	}
+
+	if old := c.entries[e.id]; old != nil && old.handler == "" {
+		e.id = c.genid(0)
+	}
+	c.entries[e.id] = e
+	if e.id > c.idmgr {
+		c.idmgr = e.id
+	}
+	return e.id, nil
+}
+
+// records 返回需要持久化的任务记录，ids为空时返回全部。
+func (c *crontab) records(ids ...uint64) []*JobRecord {
+	var recs []*JobRecord
+	if len(ids) == 0 {
+		for _, e := range c.entries {
+			if e.handler != "" {
+				recs = append(recs, e.record())
+			}
+		}
+		return recs
+	}
+	for _, id := range ids {
+		if e := c.entries[id]; e != nil && e.handler != "" {
+			recs = append(recs, e.record())
+		}
+	}
+	return recs
+}
+
+// update 用新的表达式重新调度任务。直接修改原来的Entry，
+// 任务的命令、配置以及正在执行、排队的状态都保持不变。
+func (c *crontab) update(id uint64, str string) error {
+	e := c.entries[id]
+	if e == nil {
+		return fmt.Errorf("job not found:%d", id)
 	}
 
-	return c.addSchedule(id, strs[0], strs[1], strs[2], strs[3], strs[4], cmd, args...)
+	tmp, err := parseSchedule(id, str, nil)
+	if err != nil {
+		return err
+	}
+	e.minute, e.hour, e.dom, e.month, e.dow = tmp.minute, tmp.hour, tmp.dom, tmp.month, tmp.dow
+	e.at, e.every, e.start, e.done = tmp.at, tmp.every, tmp.start, false
+	e.expr = tmp.expr
+	return nil
+}
+
+func (c *crontab) clear() {
+	c.entries = make(map[uint64]*Entry)
+}
+
+func (c *crontab) setPaused(id uint64, paused bool) error {
+	e := c.entries[id]
+	if e == nil {
+		return fmt.Errorf("job not found:%d", id)
+	}
+	e.paused = paused
+	return nil
 }
 
-func (c *crontab) findJobs(es map[uint64]struct{}, t time.Time) {
+func (c *crontab) list(now time.Time) []JobInfo {
+	loc := c.location()
+	infos := make([]JobInfo, 0, len(c.entries))
 	for _, e := range c.entries {
-		if e.Test(t) {
-			es[e.id] = struct{}{}
+		info := JobInfo{
+			ID:     e.id,
+			Expr:   e.expr,
+			Paused: e.paused,
+		}
+		if !e.paused {
+			info.Next = e.next(now, loc)
 		}
+		infos = append(infos, info)
 	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
 }
 
-func (c *crontab) do(id uint64) {
+func (c *crontab) configure(id uint64, opts ...JobOption) error {
 	e := c.entries[id]
 	if e == nil {
-		return
+		return fmt.Errorf("job not found:%d", id)
+	}
+	e.exec.configure(func() {
+		for _, opt := range opts {
+			opt(e)
+		}
+	})
+	return nil
+}
+
+func (c *crontab) location() *time.Location {
+	if c.loc == nil {
+		return time.Local
+	}
+	return c.loc
+}
+
+// findJobs 找出在t这一分钟到期的任务。
+func (c *crontab) findJobs(es map[uint64][]time.Time, t time.Time) {
+	c.findJobsIn(es, t, c.location())
+}
+
+// findJobsIn 同findJobs，但没有指定时区的任务按loc的墙上时间匹配。
+func (c *crontab) findJobsIn(es map[uint64][]time.Time, t time.Time, loc *time.Location) {
+	t = t.Truncate(time.Minute)
+	for _, e := range c.entries {
+		if !e.paused && e.due(t, loc) {
+			es[e.id] = append(es[e.id], t)
+		}
+	}
+}
+
+// schedule 处理时钟走到t这一分钟：找出到期的任务，并按各任务的MisfirePolicy
+// 处理上次处理之后错过的时刻（停服、时间往前跳）。时间往回拨时，已经处理过的
+// 时刻不会再触发。返回发现错过执行的任务。
+func (c *crontab) schedule(es map[uint64][]time.Time, t time.Time) []MisfireInfo {
+	t = t.Truncate(time.Minute)
+	loc := c.location()
+	var misfires []MisfireInfo
+	for _, e := range c.entries {
+		since := e.last
+		if since.IsZero() {
+			if c.lastRunTime > 0 {
+				since = time.Unix(c.lastRunTime, 0)
+			} else {
+				since = t.Add(-time.Minute)
+			}
+		}
+		if !t.After(since) {
+			continue
+		}
+		e.last = t
+		if !e.at.IsZero() && !e.at.After(t) {
+			e.done = true
+		}
+		if e.paused {
+			continue
+		}
+
+		pending := len(es[e.id])
+		missed := e.misfired(since, t.Add(-time.Minute), loc)
+		es[e.id] = append(es[e.id], missed...)
+		if len(missed) > 0 || (since.Before(t.Add(-time.Minute)) &&
+			!e.prev(t.Add(-time.Minute), since, loc).IsZero()) {
+			e.exec.misfire()
+			misfires = append(misfires, MisfireInfo{e.id, since, t.Add(-time.Minute), len(missed)})
+		}
+		//还没Process的正常执行会合并成一次
+		if pending == 0 && e.due(t, loc) {
+			es[e.id] = append(es[e.id], t)
+		}
+		if len(es[e.id]) == 0 {
+			delete(es, e.id)
+		}
 	}
-	if e.cmd != nil {
-		e.cmd(e.args...)
+	if t.Unix() > c.lastRunTime {
+		c.lastRunTime = t.Unix()
 	}
+	return misfires
+}
+
+// sweep 删除已经触发并且没有待执行的一次性任务，返回其中需要从存储删除的id。
+func (c *crontab) sweep(es map[uint64][]time.Time) []uint64 {
+	var ids []uint64
+	for id, e := range c.entries {
+		if !e.done || len(es[id]) > 0 {
+			continue
+		}
+		if e.handler != "" {
+			ids = append(ids, id)
+		}
+		delete(c.entries, id)
+	}
+	return ids
+}
+
+// untilNextMinute 返回从now到下一个整分的时长，最低细粒度60秒，目前只支持到每分钟。
+func untilNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
 }
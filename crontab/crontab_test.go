@@ -1,8 +1,14 @@
 package crontab
 
 import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/Lei2050/lei-utils/work_pool"
 )
 
 func TestCrontab(t *testing.T) {
@@ -91,3 +97,733 @@ func TestCrontab(t *testing.T) {
 		cron.Process()
 	}
 }
+
+func TestCrontabDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	cron := New()
+	cron.SetLocation(ny)
+	skipped, _ := cron.AddScheduleByStr(0, "30 2 * * 7", nil)
+	repeated, _ := cron.AddScheduleByStr(0, "30 1 * * 7", nil)
+	utc, _ := cron.AddScheduleByStr(0, "0 7 * * 7", nil)
+	cron.Configure(utc, WithLocation(time.UTC))
+
+	fired := func(start time.Time, minutes int) map[uint64][]time.Time {
+		ret := make(map[uint64][]time.Time)
+		for i := 0; i < minutes; i++ {
+			tm := start.Add(time.Duration(i) * time.Minute)
+			es := make(map[uint64][]time.Time)
+			cron.cron.findJobs(es, tm)
+			for id := range es {
+				ret[id] = append(ret[id], tm)
+			}
+		}
+		return ret
+	}
+
+	//2021-03-14 02:00 EST跳到03:00 EDT，02:30不存在
+	ret := fired(time.Date(2021, 3, 14, 5, 0, 0, 0, time.UTC), 180)
+	if len(ret[skipped]) != 1 || !ret[skipped][0].Equal(time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("skipped hour: %v", ret[skipped])
+	}
+	if len(ret[utc]) != 1 || !ret[utc][0].Equal(time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("utc: %v", ret[utc])
+	}
+
+	//2021-11-07 02:00 EDT回拨到01:00 EST，01:30出现两次
+	ret = fired(time.Date(2021, 11, 7, 4, 0, 0, 0, time.UTC), 180)
+	if len(ret[repeated]) != 1 || !ret[repeated][0].Equal(time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC)) {
+		t.Fatalf("repeated hour: %v", ret[repeated])
+	}
+}
+
+func TestCrontabFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 30, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	defer cron.Close(nil)
+
+	var n int
+	cron.AddScheduleByStr(0, "0 5 * * *", func(args ...interface{}) {
+		n++
+	})
+	cron.Start()
+
+	clock.Advance(30 * time.Second)
+	cron.Process()
+	if n != 1 {
+		t.Fatalf("expect 1 run at 05:00, got %d", n)
+	}
+
+	clock.Advance(time.Hour)
+	cron.Process()
+	if n != 1 {
+		t.Fatalf("expect no run before next day, got %d", n)
+	}
+
+	clock.Advance(23 * time.Hour)
+	cron.Process()
+	if n != 2 {
+		t.Fatalf("expect 2 runs, got %d", n)
+	}
+}
+
+func TestOffsetClockShift(t *testing.T) {
+	clock := NewOffsetClock(time.Date(2021, 8, 30, 4, 0, 0, 0, time.UTC).Unix())
+	timer := clock.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	clock.Shift(time.Hour)
+	select {
+	case now := <-timer.C():
+		if now.Before(time.Date(2021, 8, 30, 5, 0, 0, 0, time.UTC)) {
+			t.Fatalf("fired too early: %v", now)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer not fired after shift")
+	}
+}
+
+func TestCrontabManage(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 0, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	defer cron.Close(nil)
+
+	var n int
+	id, _ := cron.AddScheduleByStr(0, "* * * * *", func(args ...interface{}) {
+		n++
+	})
+	cron.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tmp, _ := cron.AddScheduleByStr(0, "0 6 * * *", nil)
+				cron.List()
+				cron.Remove(tmp)
+			}
+		}()
+	}
+	clock.Advance(10 * time.Minute)
+	wg.Wait()
+	cron.Process()
+	if n != 1 {
+		t.Fatalf("expect 1 run, got %d", n)
+	}
+
+	cron.Pause(id)
+	clock.Advance(time.Minute)
+	cron.Process()
+	if n != 1 {
+		t.Fatalf("paused job ran")
+	}
+	if infos := cron.List(); len(infos) != 1 || !infos[0].Paused || !infos[0].Next.IsZero() {
+		t.Fatalf("list: %+v", infos)
+	}
+
+	cron.Resume(id)
+	if err := cron.Update(id, "30 12 * * *"); err != nil {
+		t.Fatal(err)
+	}
+	infos := cron.List()
+	if infos[0].Expr != "30 12 * * *" || !infos[0].Next.Equal(time.Date(2021, 8, 30, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("list: %+v", infos)
+	}
+	if err := cron.Update(id+1, "* * * * *"); err == nil {
+		t.Fatalf("update unknown job should fail")
+	}
+
+	//并发重启和关闭
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cron.Start()
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cron.Close(nil)
+	}()
+	wg.Wait()
+	cron.Close(nil)
+	if !cron.IsClosed() {
+		t.Fatal("expect closed")
+	}
+}
+
+func TestCrontabMisfire(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 0, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	defer cron.Close(nil)
+
+	runs := make(map[string]int)
+	add := func(name string, opts ...JobOption) {
+		id, _ := cron.AddScheduleByStr(0, "0 * * * *", func(args ...interface{}) {
+			runs[args[0].(string)]++
+		}, name)
+		cron.Configure(id, opts...)
+	}
+	add("skip")
+	add("once", WithMisfire(MisfireFireOnce, 0))
+	add("all", WithMisfire(MisfireFireAll, 3))
+	cron.Start()
+
+	clock.Advance(time.Minute) //05:00
+	cron.Process()
+
+	//时间往前跳5小时，错过06:00~10:00
+	clock.Set(time.Date(2021, 8, 30, 10, 30, 0, 0, time.UTC))
+	clock.Advance(time.Minute)
+	cron.Process()
+	if runs["skip"] != 1 || runs["once"] != 2 || runs["all"] != 4 {
+		t.Fatalf("forward jump: %v", runs)
+	}
+
+	//时间往回拨，已经处理过的时刻不再触发
+	clock.Set(time.Date(2021, 8, 30, 7, 59, 30, 0, time.UTC))
+	clock.Advance(2 * time.Hour)
+	cron.Process()
+	if runs["skip"] != 1 || runs["once"] != 2 || runs["all"] != 4 {
+		t.Fatalf("backward jump: %v", runs)
+	}
+
+	clock.Advance(time.Hour + time.Minute) //11:00
+	cron.Process()
+	if runs["skip"] != 2 || runs["once"] != 3 || runs["all"] != 5 {
+		t.Fatalf("after catching up: %v", runs)
+	}
+	if cron.LastRunTime() != time.Date(2021, 8, 30, 11, 0, 0, 0, time.UTC).Unix() {
+		t.Fatalf("last run time: %d", cron.LastRunTime())
+	}
+
+	//停服一个月，不限次数的也只补执行最近的defaultMisfireMax次
+	e, _ := newEntry(1, "*", "*", "*", "*", "*", nil)
+	since := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2021, 8, 31, 0, 0, 0, 0, time.UTC)
+	WithMisfire(MisfireFireAll, 0)(e)
+	if ts := e.misfired(since, until, time.UTC); len(ts) != defaultMisfireMax ||
+		!ts[len(ts)-1].Equal(until) || !ts[0].Equal(until.Add(-(defaultMisfireMax-1)*time.Minute)) {
+		t.Fatalf("fire all: %d runs", len(ts))
+	}
+	WithMisfire(MisfireFireOnce, 0)(e)
+	if ts := e.misfired(since, until, time.UTC); len(ts) != 1 || !ts[0].Equal(until) {
+		t.Fatalf("fire once: %v", ts)
+	}
+}
+
+func TestCrontabStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	newCron := func(now time.Time) (*Crontab, *FakeClock) {
+		clock := NewFakeClock(now)
+		cron := NewWithClock(clock)
+		cron.SetLocation(time.UTC)
+		cron.SetStore(store)
+		cron.RegisterHandler("open_event", func(args ...interface{}) {
+			got = append(got, args...)
+		})
+		return cron, clock
+	}
+
+	cron, clock := newCron(time.Date(2021, 8, 30, 3, 59, 0, 0, time.UTC))
+	id, err := cron.AddNamedJob(0, "double exp", "0 4 * * *", "open_event", "exp", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cron.AddNamedJob(0, "bad", "0 4 * * *", "not_registered"); err == nil {
+		t.Fatal("unregistered handler should fail")
+	}
+	cron.Configure(id, WithMisfire(MisfireFireOnce, 0))
+	cron.Start()
+	clock.Advance(time.Minute)
+	cron.Process()
+	cron.Close(nil)
+	if len(got) != 2 || got[0] != "exp" || got[1] != 2 {
+		t.Fatalf("first run: %v", got)
+	}
+
+	//停服两天后重启，从文件恢复，错过的执行补一次
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	cron, clock = newCron(time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC))
+	//重启后先添加的固定任务占用了持久化任务的id，恢复的任务换一个id
+	static, _ := cron.AddScheduleByStr(0, "0 6 * * *", nil)
+	if static != id {
+		t.Fatalf("expect static job reuse id %d, got %d", id, static)
+	}
+	if err = cron.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	cron.Start()
+	defer cron.Close(nil)
+	clock.Advance(time.Minute)
+	cron.Process()
+	if len(got) != 2 || got[0] != "exp" || got[1] != float64(2) {
+		t.Fatalf("after restore: %v", got)
+	}
+	infos := cron.List()
+	if len(infos) != 2 || infos[0].ID != static || infos[0].Expr != "0 6 * * *" || infos[1].ID == id {
+		t.Fatalf("list: %+v", infos)
+	}
+	if recs, _ := store.Load(); len(recs) != 1 || recs[0].ID != infos[1].ID {
+		t.Fatalf("moved job not stored: %+v", recs)
+	}
+
+	cron.Remove(infos[1].ID)
+	if recs, _ := store.Load(); len(recs) != 0 {
+		t.Fatalf("removed job still stored: %+v", recs)
+	}
+}
+
+type eventArg struct {
+	name string
+	rate int
+}
+
+func TestCrontabAddFunc(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 0, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+
+	var errs []error
+	cron.OnError(func(id uint64, err error) {
+		errs = append(errs, err)
+	})
+
+	var got eventArg
+	var scheduled time.Time
+	var ctx context.Context
+	id, err := AddFunc(cron, "0 5 * * *", func(c context.Context, arg eventArg) error {
+		got, scheduled, ctx = arg, ScheduledTime(c), c
+		return errors.New("open event failed")
+	}, eventArg{"double_exp", 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cron.AddJob(0, "0 5 * * *", JobFunc(func(ctx context.Context) error {
+		panic("boom")
+	}))
+	cron.Start()
+
+	clock.Advance(time.Minute)
+	cron.Process()
+	if got.name != "double_exp" || got.rate != 2 || !scheduled.Equal(time.Date(2021, 8, 30, 5, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %+v at %v", got, scheduled)
+	}
+	if JobID(ctx) != id || len(errs) != 2 {
+		t.Fatalf("job id %d, errs %v", JobID(ctx), errs)
+	}
+
+	cron.Close(nil)
+	if ctx.Err() == nil {
+		t.Fatal("ctx should be cancelled after Close")
+	}
+}
+
+func TestCrontabExecPolicy(t *testing.T) {
+	cron := New()
+	cron.SetLocation(time.UTC)
+
+	var mu sync.Mutex
+	var errs []error
+	cron.OnError(func(id uint64, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	var attempts int
+	AddFunc(cron, "* * * * *", func(ctx context.Context, _ struct{}) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	}, struct{}{}, WithRetry(3, time.Millisecond))
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	var skipRuns, queueRuns int
+	wg.Add(3)
+	skipID, _ := AddFunc(cron, "* * * * *", func(ctx context.Context, n *int) error {
+		<-release
+		mu.Lock()
+		*n++
+		mu.Unlock()
+		wg.Done()
+		return nil
+	}, &skipRuns, WithAsync(), WithOverlap(OverlapSkip))
+	pool := work_pool.NewWorkPool(2)
+	defer pool.Stop()
+	AddFunc(cron, "* * * * *", func(ctx context.Context, n *int) error {
+		<-release
+		mu.Lock()
+		*n++
+		mu.Unlock()
+		wg.Done()
+		return nil
+	}, &queueRuns, WithWorkPool(pool), WithOverlap(OverlapQueue))
+
+	AddFunc(cron, "0 5 * * *", func(ctx context.Context, _ struct{}) error {
+		<-ctx.Done()
+		return nil
+	}, struct{}{}, WithTimeout(10*time.Millisecond))
+
+	cron.cron.findJobs(cron.es, time.Date(2021, 8, 30, 5, 0, 0, 0, time.UTC))
+	cron.Process()
+	//执行中修改表达式不影响重叠策略
+	if err := cron.Update(skipID, "*/1 * * * *"); err != nil {
+		t.Fatal(err)
+	}
+	cron.cron.findJobs(cron.es, time.Date(2021, 8, 30, 5, 1, 0, 0, time.UTC))
+	cron.Process()
+	close(release)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 4 || skipRuns != 1 || queueRuns != 2 {
+		t.Fatalf("attempts %d, skip runs %d, queue runs %d", attempts, skipRuns, queueRuns)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 timeout error, got %v", errs)
+	}
+
+	//pool停止后不能panic，通过错误回调报告
+	stopped := work_pool.NewWorkPool(1)
+	stopped.Stop()
+	id, _ := AddFunc(cron, "0 6 * * *", func(ctx context.Context, _ struct{}) error {
+		return nil
+	}, struct{}{}, WithWorkPool(stopped))
+	mu.Unlock()
+	cron.execute([]pendingRun{{cron.cron.entries[id], time.Date(2021, 8, 30, 6, 0, 0, 0, time.UTC)}}, true)
+	mu.Lock()
+	if len(errs) != 2 {
+		t.Fatalf("expect pool stopped error, got %v", errs)
+	}
+}
+
+func TestCrontabDelivery(t *testing.T) {
+	//周日用0和7都可以
+	sunday := time.Date(2021, 8, 29, 5, 0, 0, 0, time.UTC)
+	for _, str := range []string{"0 5 * * 0", "0 5 * * 7", "0 5 * * 5-7", "*/15 5 * * *"} {
+		strs, _ := splitExpr(str)
+		e, err := newEntry(1, strs[0], strs[1], strs[2], strs[3], strs[4], nil)
+		if err != nil {
+			t.Fatalf("parse %q failed:%v", str, err)
+		}
+		if !e.Test(sunday) {
+			t.Fatalf("%q should match %v", str, sunday)
+		}
+	}
+	if _, err := newEntry(1, "*/0", "*", "*", "*", "*", nil); err == nil {
+		t.Fatal("expect error for step 0")
+	}
+
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 30, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	cron.SetDelivery(DeliverExecute)
+	defer cron.Close(nil)
+
+	ch := make(chan time.Time, 1)
+	cron.AddJob(0, "0 5 * * *", JobFunc(func(ctx context.Context) error {
+		ch <- ScheduledTime(ctx)
+		return nil
+	}))
+	cron.Start()
+
+	clock.Advance(30 * time.Second)
+	select {
+	case tm := <-ch:
+		if !tm.Equal(time.Date(2021, 8, 30, 5, 0, 0, 0, time.UTC)) {
+			t.Fatalf("unexpected scheduled time %v", tm)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job not executed in DeliverExecute mode")
+	}
+	select {
+	case <-cron.C:
+		t.Fatal("C should not be notified in DeliverExecute mode")
+	default:
+	}
+
+	//CrontabMe共用Crontab的解析和执行
+	me := NewMeWithClock(NewFakeClock(sunday))
+	defer me.Close()
+	var n int
+	me.MustAddJob("0 5 * * 7", func(args ...interface{}) {
+		n++
+	})
+	me.RunScheduled(sunday)
+	me.RunScheduled(sunday.Add(time.Minute))
+	if n != 1 {
+		t.Fatalf("expect CrontabMe job run once, got %d", n)
+	}
+}
+
+func TestCrontabTimer(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 11, 1, 19, 58, 30, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	store := NewMemoryStore()
+	cron.SetStore(store)
+	defer cron.Close(nil)
+
+	runs := make(map[string][]time.Time)
+	job := func(name string) Job {
+		return JobFunc(func(ctx context.Context) error {
+			runs[name] = append(runs[name], ScheduledTime(ctx))
+			return nil
+		})
+	}
+	open := time.Date(2026, 11, 1, 20, 0, 0, 0, time.UTC)
+	if _, err := cron.AddAt(0, open, job("at")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cron.AddAt(0, open.Add(-time.Hour), job("past")); err == nil {
+		t.Fatal("expect error for passed time")
+	}
+	every, err := cron.AddEvery(0, 90*time.Minute, open.Add(-50*time.Second), job("every"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cron.AddEvery(0, 30*time.Second, open, job("bad")); err == nil {
+		t.Fatal("expect error for interval less than a minute")
+	}
+	cron.RegisterHandler("open_event", func(args ...interface{}) {
+		runs["named"] = append(runs["named"], open)
+	})
+	if _, err = cron.AddNamedJob(0, "open", AtExpr(open), "open_event"); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := store.Load(); len(recs) != 1 || recs[0].Expr != "@at 2026-11-01T20:00:00Z" {
+		t.Fatalf("stored: %+v", recs)
+	}
+	cron.Start()
+
+	clock.Advance(90 * time.Second) //20:00
+	cron.Process()
+	if len(runs["at"]) != 1 || !runs["at"][0].Equal(open) || len(runs["every"]) != 1 || len(runs["named"]) != 1 {
+		t.Fatalf("at 20:00: %v", runs)
+	}
+	//一次性任务执行后删除，存储里也删除
+	if infos := cron.List(); len(infos) != 1 || infos[0].ID != every ||
+		!infos[0].Next.Equal(open.Add(90*time.Minute)) {
+		t.Fatalf("list: %+v", infos)
+	}
+	if recs, _ := store.Load(); len(recs) != 0 {
+		t.Fatalf("finished job still stored: %+v", recs)
+	}
+
+	clock.Advance(90 * time.Minute)
+	cron.Process()
+	if len(runs["at"]) != 1 || len(runs["every"]) != 2 || !runs["every"][1].Equal(open.Add(90*time.Minute)) {
+		t.Fatalf("at 21:30: %v", runs)
+	}
+
+	cron.Remove(every)
+	if infos := cron.List(); len(infos) != 0 {
+		t.Fatalf("list after remove: %+v", infos)
+	}
+}
+
+func TestCrontabCalendar(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 9, d, 4, 0, 0, 0, time.UTC)
+	}
+	cal := NewCalendar()
+	cal.ExcludeDate(2021, 9, 1)
+	cal.ExcludeRange(day(3).Add(-time.Hour), day(3).Add(time.Hour))
+	cal.ExcludeWeekly(time.Saturday, 22*time.Hour, 29*time.Hour) //周六22:00到周日05:00
+	if err := cal.ExcludeWeekly(time.Monday, 2*time.Hour, time.Hour); err == nil {
+		t.Fatal("expect error for invalid window")
+	}
+
+	e, _ := newEntry(1, "0", "4", "*", "*", "*", nil)
+	WithCalendar(cal)(e)
+	for d, want := range map[int]bool{1: false, 2: true, 3: false, 4: true, 5: false, 6: true} {
+		if e.Test(day(d)) != want {
+			t.Fatalf("test %v expect %v", day(d), want)
+		}
+	}
+	for _, c := range [][2]int{{1, 2}, {2, 4}, {4, 6}} {
+		if next := e.Next(day(c[0])); !next.Equal(day(c[1])) {
+			t.Fatalf("next after %v: %v", day(c[0]), next)
+		}
+	}
+	WithMisfire(MisfireFireAll, 10)(e)
+	if ts := e.misfired(day(1).Add(-time.Hour), day(6).Add(-time.Hour), time.UTC); len(ts) != 2 ||
+		!ts[0].Equal(day(2)) || !ts[1].Equal(day(4)) {
+		t.Fatalf("misfired: %v", ts)
+	}
+
+	clock := NewFakeClock(day(1).Add(-30 * time.Second))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	defer cron.Close(nil)
+	var n int
+	id, _ := cron.AddScheduleByStr(0, "0 4 * * *", func(args ...interface{}) {
+		n++
+	})
+	cron.Configure(id, WithCalendar(cal))
+	cron.Start()
+	clock.Advance(time.Minute)
+	cron.Process()
+	if n != 0 {
+		t.Fatalf("excluded date ran %d times", n)
+	}
+	if infos := cron.List(); !infos[0].Next.Equal(day(2)) {
+		t.Fatalf("list: %+v", infos)
+	}
+	clock.Advance(24 * time.Hour)
+	cron.Process()
+	if n != 1 {
+		t.Fatalf("expect 1 run, got %d", n)
+	}
+}
+
+func TestCrontabLocker(t *testing.T) {
+	start := time.Date(2021, 8, 30, 4, 59, 30, 0, time.UTC)
+	lockClock := NewFakeClock(start)
+	fileLocker, err := NewFileLocker(filepath.Join(t.TempDir(), "locks"), lockClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, locker := range map[string]Locker{
+		"memory": NewMemoryLocker(lockClock),
+		"file":   fileLocker,
+	} {
+		//两个副本运行同一个任务，每个时刻只执行一次
+		var mu sync.Mutex
+		var runs []time.Time
+		crons := make([]*Crontab, 2)
+		clocks := make([]*FakeClock, 2)
+		for i := range crons {
+			clocks[i] = NewFakeClock(start)
+			crons[i] = NewWithClock(clocks[i])
+			crons[i].SetLocation(time.UTC)
+			crons[i].AddJob(0, "* * * * *", JobFunc(func(ctx context.Context) error {
+				mu.Lock()
+				runs = append(runs, ScheduledTime(ctx))
+				mu.Unlock()
+				return nil
+			}), WithLocker(locker, 5*time.Minute))
+			crons[i].Start()
+			defer crons[i].Close(nil)
+		}
+		for i := 0; i < 2; i++ {
+			for j := range crons {
+				clocks[j].Advance(time.Minute)
+				crons[j].Process()
+			}
+		}
+		if len(runs) != 2 || runs[0].Equal(runs[1]) {
+			t.Fatalf("%s: runs %v", name, runs)
+		}
+
+		//过期后可以再次获得
+		if ok, _ := locker.TryLock("expire", time.Minute); !ok {
+			t.Fatalf("%s: lock failed", name)
+		}
+		if ok, _ := locker.TryLock("expire", time.Minute); ok {
+			t.Fatalf("%s: lock held twice", name)
+		}
+		lockClock.Set(lockClock.Now().Add(time.Minute))
+		if ok, _ := locker.TryLock("expire", time.Minute); !ok {
+			t.Fatalf("%s: lock not expired", name)
+		}
+	}
+	lockClock.Set(lockClock.Now().Add(time.Hour))
+	if err = fileLocker.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(fileLocker.dir, "*.lock")); len(names) != 0 {
+		t.Fatalf("expired locks not pruned: %v", names)
+	}
+}
+
+func TestCrontabHistory(t *testing.T) {
+	clock := NewFakeClock(time.Date(2021, 8, 30, 4, 59, 30, 0, time.UTC))
+	cron := NewWithClock(clock)
+	cron.SetLocation(time.UTC)
+	defer cron.Close(nil)
+
+	var started, finished []uint64
+	var misfires []MisfireInfo
+	cron.OnError(func(id uint64, err error) {})
+	cron.OnStart(func(id uint64, scheduled time.Time) {
+		started = append(started, id)
+	})
+	cron.OnFinish(func(rec RunRecord) {
+		finished = append(finished, rec.ID)
+	})
+	cron.OnMisfire(func(info MisfireInfo) {
+		misfires = append(misfires, info)
+	})
+
+	var n int
+	id, _ := cron.AddJob(0, "* * * * *", JobFunc(func(ctx context.Context) error {
+		n++
+		switch n {
+		case 1:
+			return errors.New("boom")
+		case 2:
+			panic("oops")
+		}
+		return nil
+	}), WithHistory(2))
+	cron.Start()
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		cron.Process()
+	}
+	if len(started) != 3 || len(finished) != 3 || finished[0] != id {
+		t.Fatalf("hooks: started %v, finished %v", started, finished)
+	}
+	hist, err := cron.History(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 2 || hist[0].Err == nil || hist[1].Err != nil ||
+		!hist[1].Scheduled.Equal(time.Date(2021, 8, 30, 5, 2, 0, 0, time.UTC)) || hist[1].Attempts != 1 {
+		t.Fatalf("history: %+v", hist)
+	}
+	stats, _ := cron.Stats(id)
+	if stats.Runs != 3 || stats.Failures != 2 || stats.LastErr == nil {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	//时间往前跳，错过的执行按默认策略丢弃，但会通知
+	clock.Set(clock.Now().Add(time.Hour))
+	clock.Advance(time.Minute)
+	cron.Process()
+	if len(misfires) != 1 || misfires[0].ID != id || misfires[0].Fired != 0 {
+		t.Fatalf("misfires: %+v", misfires)
+	}
+	if stats, _ = cron.Stats(id); stats.Misfires != 1 || stats.Runs != 4 {
+		t.Fatalf("stats after misfire: %+v", stats)
+	}
+	if _, err = cron.History(id + 1); err == nil {
+		t.Fatal("expect error for unknown job")
+	}
+}
@@ -2,24 +2,82 @@ package crontab
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/Lei2050/lei-utils/bitmap"
-	"github.com/Lei2050/lei-utils/types"
 )
 
 type Entry struct {
-	minute bitmap.Bitmap //分
-	hour   bitmap.Bitmap //时
-	dom    bitmap.Bitmap //月天
-	month  bitmap.Bitmap //月
-	dow    bitmap.Bitmap //周天
+	minute uint64 //分
+	hour   uint64 //时
+	dom    uint64 //月天
+	month  uint64 //月
+	dow    uint64 //周天，0和7都表示周日
 
 	id   uint64
 	cmd  func(args ...interface{})
 	args []interface{}
+	job  Job
+
+	at    time.Time     //AddAt添加的一次性任务的触发时刻
+	every time.Duration //AddEvery添加的任务的间隔
+	start time.Time     //AddEvery添加的任务的第一次触发时刻
+	done  bool          //一次性任务已经触发，执行后会被删除
+
+	expr   string
+	loc    *time.Location //为nil时使用所在Crontab的时区
+	paused bool
+
+	misfire    MisfirePolicy
+	misfireMax int
+	last       time.Time //最后处理到的时刻，错过的执行从这之后算起
+
+	cal *Calendar //排除日历，为nil表示不排除
+
+	exec execPolicy
+
+	name    string
+	handler string //不为空时表示是需要持久化的任务
+}
+
+// MisfirePolicy 决定停服或时间跳变期间错过的执行如何处理。
+type MisfirePolicy int
+
+const (
+	MisfireSkip     MisfirePolicy = iota //丢弃错过的执行（默认）
+	MisfireFireOnce                      //不管错过几次，补执行一次
+	MisfireFireAll                       //每次错过都补执行，最多misfireMax次
+)
+
+// defaultMisfireMax 是MisfireFireAll没有指定次数时最多补执行的次数。
+const defaultMisfireMax = 100
+
+// JobInfo 描述一个任务的当前状态，由Crontab.List返回。
+type JobInfo struct {
+	ID     uint64
+	Expr   string
+	Next   time.Time //下次执行时间，暂停的任务为零值
+	Paused bool
+}
+
+// JobOption 用于配置单个任务。
+type JobOption func(*Entry)
+
+// WithMisfire 设置错过执行时的处理策略。
+// 对于MisfireFireAll，max为最多补执行的次数，取最近的max次，max<=0时最多补执行100次。
+func WithMisfire(policy MisfirePolicy, max int) JobOption {
+	return func(e *Entry) {
+		e.misfire = policy
+		e.misfireMax = max
+	}
+}
+
+// WithLocation 指定任务按哪个时区的墙上时间匹配，覆盖Crontab的时区设置。
+func WithLocation(loc *time.Location) JobOption {
+	return func(e *Entry) {
+		e.loc = loc
+	}
 }
 
 func newEntry(id uint64,
@@ -30,82 +88,378 @@ func newEntry(id uint64,
 		cmd:  cmd,
 		args: args,
 	}
+	if cmd != nil {
+		e.job = cmdJob{cmd, args}
+	}
+	fields := []string{minute, hour, dom, month, dow}
+	for i, f := range fields {
+		if f == "" {
+			fields[i] = "*"
+		}
+	}
+	e.expr = strings.Join(fields, " ")
 
 	var err error
 
-	err = getRange(&e.minute, FirstMinute, LastMinute, minute)
+	e.minute, err = parsePart(fields[0], FirstMinute, LastMinute)
 	if err != nil {
 		return nil, err
 	}
 
-	err = getRange(&e.hour, FirstHour, LastHour, hour)
+	e.hour, err = parsePart(fields[1], FirstHour, LastHour)
 	if err != nil {
 		return nil, err
 	}
 
-	err = getRange(&e.dom, FirstDOM, LastDOM, dom)
+	e.dom, err = parsePart(fields[2], FirstDOM, LastDOM)
 	if err != nil {
 		return nil, err
 	}
 
-	err = getRange(&e.month, FirstMonth, LastMonth, month)
+	e.month, err = parsePart(fields[3], FirstMonth, LastMonth)
 	if err != nil {
 		return nil, err
 	}
 
-	err = getRange(&e.dow, FirstDOW, LastDOW, dow)
+	e.dow, err = parsePart(fields[4], FirstDOW, LastDOW+1)
 	if err != nil {
 		return nil, err
 	}
+	if e.dow&(1<<7) != 0 {
+		e.dow = e.dow&^(1<<7) | 1<<0
+	}
 
 	return e, nil
 }
 
-func getRange(bitset *bitmap.Bitmap, low, high int, input string) error {
-	var num1, num2, num3 int
-	if input == "" || input == "*" {
-		num1, num2, num3 = low, high, 1
-	} else if strings.Contains(input, ",") {
-		nums := types.StringToIntegerSlice[uint32](input, ",")
-		if nums == nil {
-			return fmt.Errorf("parse numbers failed:%s", input)
+// regexps for parsing schedule string
+var (
+	matchN     = regexp.MustCompile(`(.*)/(\d+)`)
+	matchRange = regexp.MustCompile(`^(\d+)-(\d+)$`)
+)
+
+// parsePart parse individual schedule part from schedule string
+func parsePart(s string, min, max int) (uint64, error) {
+	var r uint64
+
+	// wildcard pattern
+	if s == "*" {
+		for i := min; i <= max; i++ {
+			r |= 1 << i
 		}
-		for _, v := range nums {
-			bitset.Set(v)
+		return r, nil
+	}
+
+	// */2 1-59/5 pattern
+	if matches := matchN.FindStringSubmatch(s); matches != nil {
+		localMin := min
+		localMax := max
+		if matches[1] != "" && matches[1] != "*" {
+			if rng := matchRange.FindStringSubmatch(matches[1]); rng != nil {
+				localMin, _ = strconv.Atoi(rng[1])
+				localMax, _ = strconv.Atoi(rng[2])
+				if localMin < min || localMax > max {
+					return 0, fmt.Errorf("out of range for %s in %s. %s must be in range %d-%d", rng[1], s, rng[1], min, max)
+				}
+			} else {
+				return 0, fmt.Errorf("unable to parse %s part in %s", matches[1], s)
+			}
+		}
+		n, _ := strconv.Atoi(matches[2])
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid step in %s", s)
 		}
+		for i := localMin; i <= localMax; i += n {
+			r |= 1 << i
+		}
+		return r, nil
+	}
+
+	// 1,2,4  or 1,2,10-15,20,30-45 pattern
+	parts := strings.Split(s, ",")
+	for _, x := range parts {
+		if rng := matchRange.FindStringSubmatch(x); rng != nil {
+			localMin, _ := strconv.Atoi(rng[1])
+			localMax, _ := strconv.Atoi(rng[2])
+			if localMin < min || localMax > max {
+				return 0, fmt.Errorf("out of range for %s in %s. %s must be in range %d-%d", x, s, x, min, max)
+			}
+			for i := localMin; i <= localMax; i++ {
+				r |= 1 << i
+			}
+		} else if i, err := strconv.Atoi(x); err == nil {
+			if i < min || i > max {
+				return 0, fmt.Errorf("out of range for %d in %s. %d must be in range %d-%d", i, s, i, min, max)
+			}
+			r |= 1 << i
+		} else {
+			return 0, fmt.Errorf("unable to parse %s part in %s", x, s)
+		}
+	}
+
+	return r, nil
+}
+
+func (e *Entry) record() *JobRecord {
+	rec := &JobRecord{
+		ID:         e.id,
+		Name:       e.name,
+		Expr:       e.expr,
+		Handler:    e.handler,
+		Args:       e.args,
+		Misfire:    e.misfire,
+		MisfireMax: e.misfireMax,
+		Paused:     e.paused,
+	}
+	if e.loc != nil {
+		rec.Location = e.loc.String()
+	}
+	if !e.last.IsZero() {
+		rec.LastRun = e.last.Unix()
+	}
+	return rec
+}
+
+// Test 判断t对应的墙上时间是否匹配该任务，落在排除日历里的不匹配。
+// 如果任务指定了时区，则先把t转换到该时区；否则使用t自身的时区。
+func (e *Entry) Test(t time.Time) bool {
+	if e.excluded(t, t.Location()) {
+		return false
+	}
+	if e.isTimer() {
+		return e.timerDue(t.Truncate(time.Minute))
+	}
+	if e.loc != nil {
+		t = t.In(e.loc)
+	}
+	return e.match(t)
+}
+
+// excluded 判断t是否落在任务的排除日历里，日期按任务的时区（没有则按loc）计算。
+func (e *Entry) excluded(t time.Time, loc *time.Location) bool {
+	if e.cal == nil {
+		return false
+	}
+	if e.loc != nil {
+		loc = e.loc
+	}
+	return e.cal.Excluded(t.In(loc))
+}
+
+// skipExcluded 如果t落在排除日历里，返回该排除时段的起止时刻。
+func (e *Entry) skipExcluded(t time.Time, loc *time.Location) (start, end time.Time, ok bool) {
+	if e.cal == nil {
+		return
+	}
+	if e.loc != nil {
+		loc = e.loc
+	}
+	return e.cal.window(t.In(loc))
+}
+
+func (e *Entry) match(t time.Time) bool {
+	return has(e.minute, t.Minute()) &&
+		has(e.hour, t.Hour()) &&
+		has(e.dom, t.Day()) &&
+		has(e.month, int(t.Month())) &&
+		has(e.dow, int(t.Weekday()))
+}
+
+func has(mask uint64, i int) bool {
+	return mask&(1<<i) != 0
+}
+
+// due 判断任务是否应在整分时刻t触发，墙上时间按loc计算。
+// 夏令时的处理：
+//   - 时钟拨快跳过的那段墙上时间里如果有匹配的分钟，在跳变后的第一个整分触发一次；
+//   - 时钟拨慢重复出现的那段墙上时间，只在第一次出现时触发。
+func (e *Entry) due(t time.Time, loc *time.Location) bool {
+	if e.excluded(t, loc) {
+		return false
+	}
+	if e.isTimer() {
+		return e.timerDue(t)
+	}
+	if e.loc != nil {
+		loc = e.loc
+	}
+	cur := t.In(loc)
+	if e.match(cur) && resolveWall(wallOf(cur), loc).Equal(t) {
+		return true
+	}
+
+	prev := wallOf(t.Add(-time.Minute).In(loc))
+	for w := prev.Add(time.Minute); w.Before(wallOf(cur)); w = w.Add(time.Minute) {
+		if e.match(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// misfired 按错过执行的策略返回(since, until]之间需要补执行的时刻。
+// 从until往前找，最多找补执行的次数，停服很久也不会遍历所有错过的时刻。
+func (e *Entry) misfired(since, until time.Time, loc *time.Location) []time.Time {
+	if e.misfire == MisfireSkip || !until.After(since) {
 		return nil
-	} else if strings.Contains(input, "-") {
-		nums := types.StringToIntegerSlice[int](input, "-")
-		if nums == nil {
-			return fmt.Errorf("parse range numbers failed:%s", input)
+	}
+
+	n := 1
+	if e.misfire == MisfireFireAll {
+		n = e.misfireMax
+		if n <= 0 {
+			n = defaultMisfireMax
+		}
+	}
+	var ts []time.Time
+	for t := e.prev(until, since, loc); !t.IsZero() && len(ts) < n; t = e.prev(t.Add(-time.Second), since, loc) {
+		ts = append(ts, t)
+	}
+	for i, j := 0, len(ts)-1; i < j; i, j = i+1, j-1 {
+		ts[i], ts[j] = ts[j], ts[i]
+	}
+	return ts
+}
+
+// prev 返回(after, before]之间该任务最后一次触发的时刻，没有则返回零值。
+// 落在排除时段内的时刻跳过。
+func (e *Entry) prev(before, after time.Time, loc *time.Location) time.Time {
+	for {
+		t := e.prevMatch(before, after, loc)
+		if t.IsZero() {
+			return t
+		}
+		start, _, ok := e.skipExcluded(t, loc)
+		if !ok {
+			return t
+		}
+		before = start.Add(-time.Nanosecond)
+	}
+}
+
+func (e *Entry) prevMatch(before, after time.Time, loc *time.Location) time.Time {
+	if e.isTimer() {
+		return e.timerPrev(before, after)
+	}
+	if e.loc != nil {
+		loc = e.loc
+	}
+	w := wallOf(before.In(loc))
+	//夏令时前后墙上时间和实际时刻最多差几个小时，多往前找一些
+	limit := wallOf(after.In(loc)).Add(-3 * time.Hour)
+	for w.After(limit) {
+		y, m, d := w.Date()
+		if !has(e.month, int(m)) {
+			w = time.Date(y, m, 1, 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
+		}
+		if !has(e.dom, d) || !has(e.dow, int(w.Weekday())) {
+			w = time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
 		}
-		if len(nums) != 2 {
-			return fmt.Errorf("parse range numbers failed:%s", input)
+		if !has(e.hour, w.Hour()) {
+			w = time.Date(y, m, d, w.Hour(), 0, 0, 0, time.UTC).Add(-time.Minute)
+			continue
 		}
-		num1, num2, num3 = nums[0], nums[1], 1
-	} else {
-		num, err := strconv.ParseUint(input, 10, 64)
-		if err != nil {
-			return err
+		if has(e.minute, w.Minute()) {
+			t := resolveWall(w, loc)
+			if !t.After(after) {
+				return time.Time{}
+			}
+			if !t.After(before) {
+				return t
+			}
 		}
-		num1, num2, num3 = int(num), int(num), 1
+		w = w.Add(-time.Minute)
 	}
+	return time.Time{}
+}
+
+// Next 返回after之后该任务第一次触发的时刻，五年内不会触发则返回零值。
+// 如果任务指定了时区，按该时区计算；否则使用after自身的时区。
+func (e *Entry) Next(after time.Time) time.Time {
+	return e.next(after, after.Location())
+}
 
-	for i := num1; i <= num2; i += num3 {
-		bitset.Set(uint32(i))
+// next 返回after之后该任务第一次触发的时刻，落在排除时段内的时刻跳过。
+func (e *Entry) next(after time.Time, loc *time.Location) time.Time {
+	limit := after.AddDate(5, 0, 0)
+	for {
+		t := e.nextMatch(after, loc)
+		if t.IsZero() {
+			return t
+		}
+		_, end, ok := e.skipExcluded(t, loc)
+		if !ok {
+			return t
+		}
+		if after = end.Add(-time.Nanosecond); after.After(limit) {
+			return time.Time{}
+		}
 	}
+}
 
-	return nil
+func (e *Entry) nextMatch(after time.Time, loc *time.Location) time.Time {
+	if e.isTimer() {
+		return e.timerNext(after)
+	}
+	if e.loc != nil {
+		loc = e.loc
+	}
+	w := wallOf(after.In(loc)).Add(time.Minute)
+	limit := w.AddDate(5, 0, 0)
+	for w.Before(limit) {
+		y, m, d := w.Date()
+		if !has(e.month, int(m)) {
+			w = time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(e.dom, d) || !has(e.dow, int(w.Weekday())) {
+			w = time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(e.hour, w.Hour()) {
+			w = time.Date(y, m, d, w.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if has(e.minute, w.Minute()) {
+			if t := resolveWall(w, loc); t.After(after) {
+				return t
+			}
+		}
+		w = w.Add(time.Minute)
+	}
+	return time.Time{}
 }
 
-func (e *Entry) Test(t time.Time) bool {
-	weekday := t.Weekday()
-	if weekday == time.Sunday {
-		weekday = 7
-	}
-	return e.minute.Contains(uint32(t.Minute())) &&
-		e.hour.Contains(uint32(t.Hour())) &&
-		e.dom.Contains(uint32(t.Day())) &&
-		e.month.Contains(uint32(t.Month())) &&
-		e.dow.Contains(uint32(weekday))
+// wallOf 返回与t墙上时间相同的UTC时间，便于按墙上时间做加减而不受夏令时影响。
+func wallOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// resolveWall 把墙上时间w转换成loc中的实际时刻。
+// 不存在的墙上时间（夏令时跳过）取跳变时刻；重复的墙上时间取较早的那个。
+func resolveWall(w time.Time, loc *time.Location) time.Time {
+	t := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+	if got := wallOf(t); !got.Equal(w) {
+		start, end := t.ZoneBounds()
+		if got.Before(w) {
+			return end
+		}
+		return start
+	}
+
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return t
+	}
+	_, offset := t.Zone()
+	_, prevOffset := start.Add(-time.Nanosecond).Zone()
+	if prevOffset > offset {
+		earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+		if earlier.Before(start) && wallOf(earlier.In(loc)).Equal(w) {
+			return earlier
+		}
+	}
+	return t
 }
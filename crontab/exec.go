@@ -0,0 +1,256 @@
+package crontab
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Lei2050/lei-utils/log"
+	"github.com/Lei2050/lei-utils/work_pool"
+)
+
+// OverlapPolicy 决定异步执行的任务上一次还没结束时，新的一次如何处理。
+type OverlapPolicy int
+
+const (
+	OverlapAllow OverlapPolicy = iota //同时执行（默认）
+	OverlapSkip                       //丢弃这一次
+	OverlapQueue                      //排队，等上一次结束后再执行，最多排maxQueued次
+)
+
+// maxQueued 是OverlapQueue最多排队的次数，超出的丢弃并通过错误回调报告。
+const maxQueued = 100
+
+// execConfig 是任务的执行策略。
+type execConfig struct {
+	async   bool
+	pool    *work_pool.WorkerPool
+	overlap OverlapPolicy
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	locker  Locker
+	lockTTL time.Duration
+	history int //保留的执行历史条数
+}
+
+type execPolicy struct {
+	mu      sync.Mutex //保护cfg、运行状态和执行历史，任务执行时Configure可能同时在修改
+	cfg     execConfig
+	running int
+	queued  []time.Time
+
+	hist     []RunRecord //环形缓冲区
+	histNext int
+	stats    JobStats
+}
+
+// WithAsync 让任务在单独的goroutine中执行，不阻塞其它任务。
+func WithAsync() JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.async = true
+	}
+}
+
+// WithWorkPool 让任务在pool中执行，由pool控制最大并发数。
+func WithWorkPool(pool *work_pool.WorkerPool) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.pool = pool
+	}
+}
+
+// WithOverlap 设置异步执行时的重叠策略，对同步执行的任务无效。
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.overlap = policy
+	}
+}
+
+// WithTimeout 设置每次执行的超时时间。超时通过ctx通知任务，任务需要自己检查ctx。
+func WithTimeout(d time.Duration) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.timeout = d
+	}
+}
+
+// WithRetry 设置任务返回错误时的重试次数，第i次重试前等待backoff*2^(i-1)。
+func WithRetry(max int, backoff time.Duration) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.retries = max
+		e.exec.cfg.backoff = backoff
+	}
+}
+
+func (p *execPolicy) config() execConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg
+}
+
+func (p *execPolicy) configure(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f()
+}
+
+// hooks 是Crontab设置的回调，执行任务时调用。
+type hooks struct {
+	onError  func(id uint64, err error)
+	onStart  func(id uint64, scheduled time.Time)
+	onFinish func(rec RunRecord)
+}
+
+func (h *hooks) report(id uint64, err error) {
+	if h.onError != nil {
+		h.onError(id, err)
+	} else {
+		log.Errorf("crontab job %d failed:%v", id, err)
+	}
+}
+
+// dispatch 按任务的执行策略执行计划时刻为tm的这一次，结果通过h返回。
+// 同步执行的任务在当前goroutine中执行完才返回；async为true时强制异步。
+// 设置了Locker的任务先加锁，没获得锁说明别的进程执行了这一次，直接跳过。
+func (e *Entry) dispatch(ctx context.Context, clock Clock, tm time.Time, async bool, h *hooks) {
+	p := &e.exec
+	cfg := p.config()
+	if cfg.locker != nil {
+		ok, err := cfg.locker.TryLock(lockKey(e.id, tm), cfg.lockTTL)
+		if err != nil {
+			h.report(e.id, fmt.Errorf("job %d lock failed:%v", e.id, err))
+		}
+		if !ok {
+			p.skip()
+			return
+		}
+	}
+	if !async && !cfg.async && cfg.pool == nil {
+		e.run(ctx, clock, &cfg, tm, h)
+		return
+	}
+
+	p.mu.Lock()
+	if p.running > 0 {
+		switch cfg.overlap {
+		case OverlapSkip:
+			p.stats.Skipped++
+			p.mu.Unlock()
+			return
+		case OverlapQueue:
+			if len(p.queued) >= maxQueued {
+				p.stats.Skipped++
+				p.mu.Unlock()
+				h.report(e.id, fmt.Errorf("job %d queue full, run at %v dropped", e.id, tm))
+				return
+			}
+			p.queued = append(p.queued, tm)
+			p.mu.Unlock()
+			return
+		}
+	}
+	p.running++
+	p.mu.Unlock()
+
+	task := func() {
+		for {
+			e.run(ctx, clock, &cfg, tm, h)
+
+			p.mu.Lock()
+			if len(p.queued) == 0 {
+				p.running--
+				p.mu.Unlock()
+				return
+			}
+			tm = p.queued[0]
+			p.queued = p.queued[1:]
+			p.mu.Unlock()
+		}
+	}
+	if cfg.pool == nil {
+		go task()
+		return
+	}
+	if err := submit(cfg.pool, task); err != nil {
+		p.mu.Lock()
+		p.running--
+		p.stats.Skipped++
+		p.mu.Unlock()
+		h.report(e.id, fmt.Errorf("job %d:%v", e.id, err))
+	}
+}
+
+// submit 把任务交给pool。pool已经停止时返回错误，不能让调度的goroutine panic。
+func submit(pool *work_pool.WorkerPool, task func()) (err error) {
+	if pool.Stopped() {
+		return fmt.Errorf("work pool stopped")
+	}
+	defer func() {
+		//检查之后、提交之前pool被停止
+		if r := recover(); r != nil {
+			err = fmt.Errorf("work pool stopped")
+		}
+	}()
+	pool.Submit(task)
+	return nil
+}
+
+// run 执行一次任务，记录执行历史并调用回调。
+func (e *Entry) run(ctx context.Context, clock Clock, cfg *execConfig, tm time.Time, h *hooks) {
+	if h.onStart != nil {
+		h.onStart(e.id, tm)
+	}
+	start := clock.Now()
+	attempts, err := e.execute(ctx, clock, cfg, tm)
+	end := clock.Now()
+
+	rec := RunRecord{
+		ID:        e.id,
+		Scheduled: tm,
+		Start:     start,
+		End:       end,
+		Duration:  end.Sub(start),
+		Attempts:  attempts,
+		Err:       err,
+	}
+	e.exec.finish(rec)
+	if err != nil {
+		h.report(e.id, err)
+	}
+	if h.onFinish != nil {
+		h.onFinish(rec)
+	}
+}
+
+// execute 执行一次任务，处理超时和重试，返回尝试的次数。
+func (e *Entry) execute(ctx context.Context, clock Clock, cfg *execConfig, tm time.Time) (int, error) {
+	for i := 0; ; i++ {
+		err := e.runOnce(ctx, cfg.timeout, tm)
+		if err == nil || i >= cfg.retries || ctx.Err() != nil {
+			return i + 1, err
+		}
+
+		timer := clock.NewTimer(cfg.backoff << i)
+		select {
+		case <-timer.C():
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return i + 1, err
+		}
+	}
+}
+
+func (e *Entry) runOnce(ctx context.Context, timeout time.Duration, tm time.Time) error {
+	if timeout <= 0 {
+		return runJob(ctx, e, tm)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := runJob(ctx, e, tm)
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("job %d timeout after %v", e.id, timeout)
+	}
+	return err
+}
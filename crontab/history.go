@@ -0,0 +1,150 @@
+package crontab
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultHistorySize 是每个任务默认保留的执行历史条数。
+const defaultHistorySize = 10
+
+// RunRecord 是任务的一次执行记录。
+type RunRecord struct {
+	ID        uint64
+	Scheduled time.Time //计划时刻，补执行时是错过的那个时刻
+	Start     time.Time
+	End       time.Time
+	Duration  time.Duration
+	Attempts  int   //执行的次数，重试时大于1
+	Err       error //最后一次执行的错误，panic会转换成错误
+}
+
+// JobStats 是任务的累计统计。
+type JobStats struct {
+	Runs          uint64 //执行完的次数，重试只算一次
+	Failures      uint64 //返回错误（包括panic、超时）的次数
+	Skipped       uint64 //因重叠、没获得锁、pool停止等原因跳过的次数
+	Misfires      uint64 //发现错过执行的次数，见MisfireInfo
+	TotalDuration time.Duration
+	LastRun       time.Time //最后一次执行的开始时刻
+	LastErr       error     //最后一次失败的错误
+}
+
+// MisfireInfo 描述一个任务错过的执行：(Since, Until]之间本该执行的时刻没有执行，
+// 按MisfirePolicy补执行了Fired次。
+type MisfireInfo struct {
+	ID    uint64
+	Since time.Time
+	Until time.Time
+	Fired int
+}
+
+// WithHistory 设置任务保留的执行历史条数，默认10条。
+func WithHistory(n int) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.history = n
+	}
+}
+
+// finish 记录一次执行的结果。
+func (p *execPolicy) finish(rec RunRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Runs++
+	p.stats.TotalDuration += rec.Duration
+	p.stats.LastRun = rec.Start
+	if rec.Err != nil {
+		p.stats.Failures++
+		p.stats.LastErr = rec.Err
+	}
+
+	size := p.cfg.history
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	if len(p.hist) > size || (len(p.hist) < size && p.histNext != 0) {
+		//条数改过，按时间顺序重新排列
+		hist := p.history()
+		if len(hist) > size {
+			hist = hist[len(hist)-size:]
+		}
+		p.hist, p.histNext = hist, 0
+	}
+	if len(p.hist) < size {
+		p.hist = append(p.hist, rec)
+		return
+	}
+	p.hist[p.histNext] = rec
+	p.histNext = (p.histNext + 1) % size
+}
+
+// history 按时间顺序返回执行历史，调用者需持有锁。
+func (p *execPolicy) history() []RunRecord {
+	ret := make([]RunRecord, 0, len(p.hist))
+	ret = append(ret, p.hist[p.histNext:]...)
+	return append(ret, p.hist[:p.histNext]...)
+}
+
+func (p *execPolicy) skip() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Skipped++
+}
+
+func (p *execPolicy) misfire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Misfires++
+}
+
+// History 返回任务最近的执行记录，按时间顺序。
+func (c *Crontab) History(id uint64) ([]RunRecord, error) {
+	c.mu.Lock()
+	e := c.cron.entries[id]
+	c.mu.Unlock()
+	if e == nil {
+		return nil, fmt.Errorf("job not found:%d", id)
+	}
+
+	e.exec.mu.Lock()
+	defer e.exec.mu.Unlock()
+	return e.exec.history(), nil
+}
+
+// Stats 返回任务的累计统计。
+func (c *Crontab) Stats(id uint64) (JobStats, error) {
+	c.mu.Lock()
+	e := c.cron.entries[id]
+	c.mu.Unlock()
+	if e == nil {
+		return JobStats{}, fmt.Errorf("job not found:%d", id)
+	}
+
+	e.exec.mu.Lock()
+	defer e.exec.mu.Unlock()
+	return e.exec.stats, nil
+}
+
+// OnStart 设置任务开始执行时的回调，在执行任务的goroutine中调用。
+func (c *Crontab) OnStart(f func(id uint64, scheduled time.Time)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks.onStart = f
+}
+
+// OnFinish 设置任务执行完（包括重试）时的回调，在执行任务的goroutine中调用，
+// 可以用来打日志、上报监控。
+func (c *Crontab) OnFinish(f func(rec RunRecord)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks.onFinish = f
+}
+
+// OnMisfire 设置发现任务错过执行（停服、时间往前跳）时的回调，在计时的goroutine中调用，
+// 回调里不要做耗时的操作。
+func (c *Crontab) OnMisfire(f func(info MisfireInfo)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onMisfire = f
+}
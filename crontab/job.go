@@ -0,0 +1,86 @@
+package crontab
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Job 是Crontab执行的任务。ctx在Crontab关闭时取消，
+// 可以通过JobID、ScheduledTime取得本次执行的任务id和计划时刻。
+type Job interface {
+	Run(ctx context.Context) error
+}
+
+// JobFunc 把函数适配成Job。
+type JobFunc func(ctx context.Context) error
+
+func (f JobFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// cmdJob 适配旧的func(...interface{})形式的命令。
+type cmdJob struct {
+	cmd  func(...interface{})
+	args []interface{}
+}
+
+func (j cmdJob) Run(ctx context.Context) error {
+	j.cmd(j.args...)
+	return nil
+}
+
+// funcJob 是AddFunc添加的带类型参数的任务。
+type funcJob[T any] struct {
+	fn  func(context.Context, T) error
+	arg T
+}
+
+func (j funcJob[T]) Run(ctx context.Context) error {
+	return j.fn(ctx, j.arg)
+}
+
+// AddFunc 添加一个带类型参数的任务，省去在任务里对args做类型断言。
+func AddFunc[T any](c *Crontab, str string, fn func(context.Context, T) error, arg T,
+	opts ...JobOption) (uint64, error) {
+	if fn == nil {
+		return 0, fmt.Errorf("nil job func")
+	}
+	return c.AddJob(0, str, funcJob[T]{fn: fn, arg: arg}, opts...)
+}
+
+type jobCtxKey struct{}
+
+type jobCtx struct {
+	id uint64
+	tm time.Time
+}
+
+// JobID 返回ctx对应的任务id，不是任务的ctx时返回0。
+func JobID(ctx context.Context) uint64 {
+	if v, ok := ctx.Value(jobCtxKey{}).(jobCtx); ok {
+		return v.id
+	}
+	return 0
+}
+
+// ScheduledTime 返回本次执行对应的计划时刻，补执行时是错过的那个时刻。
+func ScheduledTime(ctx context.Context) time.Time {
+	if v, ok := ctx.Value(jobCtxKey{}).(jobCtx); ok {
+		return v.tm
+	}
+	return time.Time{}
+}
+
+// runJob 执行任务，任务panic时转换成error返回。
+func runJob(ctx context.Context, e *Entry, tm time.Time) (err error) {
+	if e.job == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %d panic:%v", e.id, r)
+		}
+	}()
+	return e.job.Run(context.WithValue(ctx, jobCtxKey{}, jobCtx{e.id, tm}))
+}
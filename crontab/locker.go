@@ -0,0 +1,149 @@
+package crontab
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locker 用于多个进程（比如同一服务的多个副本）运行相同的任务时，
+// 保证每个任务的每次执行只在一个进程里执行。
+// key由任务id和计划时刻组成，各进程需要以相同的顺序添加任务或者指定id，保证id一致。
+type Locker interface {
+	// TryLock 尝试获得key，已被持有且没过期时返回false；获得后ttl时间内有效，不需要释放。
+	TryLock(key string, ttl time.Duration) (bool, error)
+}
+
+// WithLocker 让任务每次执行前先通过locker获得锁，获得失败的跳过这一次。
+// ttl应大于各进程间的时间误差，通常几分钟即可。
+func WithLocker(locker Locker, ttl time.Duration) JobOption {
+	return func(e *Entry) {
+		e.exec.cfg.locker = locker
+		e.exec.cfg.lockTTL = ttl
+	}
+}
+
+// lockKey 返回任务id在计划时刻tm这一次执行的锁。
+func lockKey(id uint64, tm time.Time) string {
+	return fmt.Sprintf("%d@%d", id, tm.Unix())
+}
+
+// MemoryLocker 在进程内加锁，主要用于测试，也可以让同一进程的多个Crontab互斥。
+type MemoryLocker struct {
+	mu    sync.Mutex
+	clock Clock
+	keys  map[string]time.Time //值为过期时刻
+}
+
+// NewMemoryLocker 创建按clock计算过期的MemoryLocker，clock为nil时使用系统时间。
+func NewMemoryLocker(clock Clock) *MemoryLocker {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &MemoryLocker{
+		clock: clock,
+		keys:  make(map[string]time.Time),
+	}
+}
+
+func (l *MemoryLocker) TryLock(key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if exp, ok := l.keys[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	for k, exp := range l.keys {
+		if !now.Before(exp) {
+			delete(l.keys, k)
+		}
+	}
+	l.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+// FileLocker 用目录里的锁文件加锁，同一台机器（或共享目录）上的多个进程可以互斥。
+// 锁文件里记录过期时刻，过期的文件在再次加锁或调用Prune时删除。
+type FileLocker struct {
+	dir   string
+	clock Clock
+}
+
+// NewFileLocker 在dir下创建锁文件，目录不存在时会创建；clock为nil时使用系统时间。
+func NewFileLocker(dir string, clock Clock) (*FileLocker, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &FileLocker{
+		dir:   dir,
+		clock: clock,
+	}, nil
+}
+
+func (l *FileLocker) TryLock(key string, ttl time.Duration) (bool, error) {
+	path := filepath.Join(l.dir, key+".lock")
+	now := l.clock.Now()
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.FormatInt(now.Add(ttl).UnixNano(), 10))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return false, err
+			}
+			return true, nil
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+		//已经有锁文件，过期了就删掉再试一次；读不出来的可能正在被别的进程写入
+		if exp, ok := l.expiry(path); !ok || now.Before(exp) {
+			return false, nil
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Prune 删除已经过期的锁文件。
+func (l *FileLocker) Prune() error {
+	names, err := filepath.Glob(filepath.Join(l.dir, "*.lock"))
+	if err != nil {
+		return err
+	}
+	now := l.clock.Now()
+	for _, name := range names {
+		if exp, ok := l.expiry(name); ok && !now.Before(exp) {
+			if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expiry 读取锁文件的过期时刻，文件正在写入或已被删除时返回false。
+func (l *FileLocker) expiry(path string) (time.Time, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
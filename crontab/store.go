@@ -0,0 +1,152 @@
+package crontab
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// JobRecord 是持久化的任务，命令通过Handler名字在Crontab.RegisterHandler注册的函数中查找。
+// Args经过JSON序列化，数字恢复后是float64。
+type JobRecord struct {
+	ID         uint64        `json:"id"`
+	Name       string        `json:"name"`
+	Expr       string        `json:"expr"`
+	Handler    string        `json:"handler"`
+	Args       []interface{} `json:"args,omitempty"`
+	Location   string        `json:"location,omitempty"`
+	Misfire    MisfirePolicy `json:"misfire,omitempty"`
+	MisfireMax int           `json:"misfire_max,omitempty"`
+	Paused     bool          `json:"paused,omitempty"`
+	LastRun    int64         `json:"last_run,omitempty"` //最后处理到的时刻（unix秒），恢复后从这之后计算错过的执行
+}
+
+// JobStore 保存Crontab中通过AddNamedJob添加的任务。
+type JobStore interface {
+	Save(rec *JobRecord) error
+	Delete(id uint64) error
+	Load() ([]*JobRecord, error)
+}
+
+// MemoryStore 把任务保存在内存里，主要用于测试。
+type MemoryStore struct {
+	mu   sync.Mutex
+	recs map[uint64]JobRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		recs: make(map[uint64]JobRecord),
+	}
+}
+
+func (s *MemoryStore) Save(rec *JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs[rec.ID] = *rec
+	return nil
+}
+
+func (s *MemoryStore) Delete(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.recs, id)
+	return nil
+}
+
+func (s *MemoryStore) Load() ([]*JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedRecords(s.recs), nil
+}
+
+// FileStore 把所有任务以JSON保存在一个文件里，每次修改都整体重写。
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	recs map[uint64]JobRecord
+}
+
+// NewFileStore 打开path对应的文件，文件不存在时视为空。
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path: path,
+		recs: make(map[uint64]JobRecord),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recs []JobRecord
+	if err = json.Unmarshal(data, &recs); err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		s.recs[rec.ID] = rec
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(rec *JobRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs[rec.ID] = *rec
+	return s.flush()
+}
+
+func (s *FileStore) Delete(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.recs[id]; !ok {
+		return nil
+	}
+	delete(s.recs, id)
+	return s.flush()
+}
+
+func (s *FileStore) Load() ([]*JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedRecords(s.recs), nil
+}
+
+// flush 先写临时文件再改名，避免写到一半时宕机把文件写坏，调用者需持有锁。
+func (s *FileStore) flush() error {
+	recs := sortedRecords(s.recs)
+	data, err := json.MarshalIndent(recs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func sortedRecords(recs map[uint64]JobRecord) []*JobRecord {
+	ret := make([]*JobRecord, 0, len(recs))
+	for _, rec := range recs {
+		rec := rec
+		ret = append(ret, &rec)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
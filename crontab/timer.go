@@ -0,0 +1,125 @@
+package crontab
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 一次性任务和固定间隔任务的表达式，以"@"开头，和cron表达式一样可以持久化：
+//
+//	@at 2026-11-01T20:00:00+08:00
+//	@every 1h30m0s 2026-11-01T20:00:00+08:00
+//
+// 时间按RFC3339格式，和cron一样以分钟为粒度，不是整分的时间向后取整。
+const (
+	exprAt    = "@at"
+	exprEvery = "@every"
+)
+
+// AtExpr 返回在t执行一次的任务表达式，可用于AddNamedJob等接受表达式的方法。
+func AtExpr(t time.Time) string {
+	return exprAt + " " + t.Format(time.RFC3339)
+}
+
+// EveryExpr 返回从startAt开始每隔interval执行一次的任务表达式。
+func EveryExpr(interval time.Duration, startAt time.Time) string {
+	return exprEvery + " " + interval.String() + " " + startAt.Format(time.RFC3339)
+}
+
+// parseSchedule 解析任务的表达式，支持cron表达式以及"@at"、"@every"。
+func parseSchedule(id uint64, str string, cmd func(...interface{}), args ...interface{}) (*Entry, error) {
+	if !strings.HasPrefix(str, "@") {
+		strs, err := splitExpr(str)
+		if err != nil {
+			return nil, err
+		}
+		return newEntry(id, strs[0], strs[1], strs[2], strs[3], strs[4], cmd, args...)
+	}
+
+	e := &Entry{
+		id:   id,
+		cmd:  cmd,
+		args: args,
+	}
+	if cmd != nil {
+		e.job = cmdJob{cmd, args}
+	}
+
+	fields := strings.Fields(str)
+	var err error
+	switch {
+	case fields[0] == exprAt && len(fields) == 2:
+		var at time.Time
+		if at, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid time in %s:%v", str, err)
+		}
+		e.at = ceilMinute(at)
+	case fields[0] == exprEvery && len(fields) == 3:
+		if e.every, err = time.ParseDuration(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid interval in %s:%v", str, err)
+		}
+		if e.every < time.Minute || e.every%time.Minute != 0 {
+			return nil, fmt.Errorf("interval must be whole minutes:%s", str)
+		}
+		var start time.Time
+		if start, err = time.Parse(time.RFC3339, fields[2]); err != nil {
+			return nil, fmt.Errorf("invalid start time in %s:%v", str, err)
+		}
+		e.start = ceilMinute(start)
+	default:
+		return nil, fmt.Errorf("schedule string must be like @at <time> or @every <interval> <start>:%s", str)
+	}
+	e.expr = strings.Join(fields, " ")
+	return e, nil
+}
+
+// ceilMinute 把t向后取整到分钟。
+func ceilMinute(t time.Time) time.Time {
+	if m := t.Truncate(time.Minute); m.Before(t) {
+		return m.Add(time.Minute)
+	}
+	return t
+}
+
+// isTimer 判断是不是AddAt、AddEvery添加的任务。
+func (e *Entry) isTimer() bool {
+	return !e.at.IsZero() || e.every > 0
+}
+
+// timerDue 判断整分时刻t是不是任务的触发时刻，和时区无关。
+func (e *Entry) timerDue(t time.Time) bool {
+	if e.every == 0 {
+		return t.Equal(e.at)
+	}
+	return !t.Before(e.start) && t.Sub(e.start)%e.every == 0
+}
+
+// timerNext 返回after之后的第一个触发时刻，一次性任务已经过期时返回零值。
+func (e *Entry) timerNext(after time.Time) time.Time {
+	if e.every == 0 {
+		if e.at.After(after) {
+			return e.at
+		}
+		return time.Time{}
+	}
+	if after.Before(e.start) {
+		return e.start
+	}
+	return e.start.Add((after.Sub(e.start)/e.every + 1) * e.every)
+}
+
+// timerPrev 返回(after, before]之间的最后一个触发时刻，没有则返回零值。
+func (e *Entry) timerPrev(before, after time.Time) time.Time {
+	t := e.at
+	if e.every > 0 {
+		if before.Before(e.start) {
+			return time.Time{}
+		}
+		t = e.start.Add(before.Sub(e.start) / e.every * e.every)
+	}
+	if t.After(after) && !t.After(before) {
+		return t
+	}
+	return time.Time{}
+}
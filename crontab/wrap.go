@@ -1,50 +1,129 @@
 package crontab
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/Lei2050/lei-utils/cls"
+	"github.com/Lei2050/lei-utils/log"
 )
 
 /*
-类似linux的crontab功能，目前不支持"* /2"语法。
-C用来做上层的串行化。
+类似linux的crontab功能，支持"*"、"1,2,5"、"1-5"、"* /2"、"10-30/5"语法，
+周天0~6表示周日到周六，7也表示周日。
+有两种投递模式：
+  - DeliverChannel（默认）：到期时通知C，上层在自己的goroutine里调用Process执行，用来做上层的串行化；
+  - DeliverExecute：到期时直接在别的goroutine执行（或按WithWorkPool在pool中执行）。
+
+所有方法都可以在任意goroutine中调用，任务里也可以增删改任务；
+DeliverChannel模式下耗时的任务可以用WithAsync、WithWorkPool放到别的goroutine执行。
+任务按Crontab的时区（默认time.Local）的墙上时间匹配，单个任务可用WithLocation另行指定。
+单个任务可以用WithCalendar排除维护时段、节假日等，排除时段内的执行直接跳过。
+时间由Clock提供，默认是系统时间；上层有自己的时间系统时可使用OffsetClock，
+GM调时间时调用OffsetClock.SetNow/Shift即可，无需重启Crontab。
 usage:
 
-	cron := crontab.New()
-	cron.Run(time.Now().Unix())
+	cron := crontab.NewWithClock(crontab.NewOffsetClock(serverNow))
+	cron.SetLocation(loc)
+	cron.Start()
 	cron.AddSchedule(...)
+	cron.AddAt(0, openTime, job)               //只执行一次
+	cron.AddEvery(0, 90*time.Minute, now, job) //每90分钟
 
 	for range cron.C {
 		cron.Process()
 	}
 */
 type Crontab struct {
-	cron crontab
+	runMu    sync.Mutex //串行化Start、Run、Close，避免并发重启时run泄漏
+	mu       sync.Mutex //保护cron、es、closer等
+	cron     crontab
+	clock    Clock
+	delivery DeliveryMode
+
+	hooks     hooks
+	onMisfire func(info MisfireInfo)
+
+	ctx    context.Context //传给任务，Close时取消
+	cancel context.CancelFunc
 
 	C  chan struct{}
-	es map[uint64]struct{} //即将要执行的
+	es map[uint64][]time.Time //即将要执行的，值为各次执行对应的计划时刻
 	wg sync.WaitGroup
 
-	cls.CloseUtil
+	closer *cls.CloseUtil //每次启动新建一个，关闭时停止对应的run
 }
 
+// DeliveryMode 决定到期的任务如何执行。
+type DeliveryMode int
+
+const (
+	DeliverChannel DeliveryMode = iota //通知C，由上层调用Process执行
+	DeliverExecute                     //直接异步执行
+)
+
 func New() *Crontab {
+	return NewWithClock(SystemClock)
+}
+
+func NewWithClock(clock Clock) *Crontab {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Crontab{
 		cron: crontab{
 			entries:     make(map[uint64]*Entry),
 			idmgr:       100000000,
+			loc:         time.Local,
 			lastRunTime: 0,
 		},
-		C:         make(chan struct{}, 10),
-		es:        make(map[uint64]struct{}),
-		CloseUtil: cls.MakeCloseUtil(),
+		clock:  clock,
+		ctx:    ctx,
+		cancel: cancel,
+		C:      make(chan struct{}, 10),
+		es:     make(map[uint64][]time.Time),
+		closer: cls.NewCloseUtil(),
 	}
 }
 
+// SetLocation 设置任务匹配所用的时区，默认为time.Local。
+// 单个任务可以通过WithLocation覆盖。
+func (c *Crontab) SetLocation(loc *time.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cron.loc = loc
+}
+
+// SetDelivery 设置投递模式，默认为DeliverChannel。
+func (c *Crontab) SetDelivery(mode DeliveryMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delivery = mode
+}
+
+// Clock 返回Crontab当前使用的时钟。
+func (c *Crontab) Clock() Clock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock
+}
+
+// Configure 修改已添加任务的配置。
+func (c *Crontab) Configure(id uint64, opts ...JobOption) error {
+	return c.modify(id, func() error {
+		return c.cron.configure(id, opts...)
+	})
+}
+
 func (c *Crontab) Remove(id uint64) {
+	c.mu.Lock()
+	store, recs := c.cron.store, c.cron.records(id)
 	c.cron.remove(id)
+	c.mu.Unlock()
+
+	if len(recs) > 0 {
+		deleteStored(store, []uint64{id})
+	}
 }
 
 // 如果提供了id，则会尽量使用该id，如果不重复的话；
@@ -52,72 +131,421 @@ func (c *Crontab) Remove(id uint64) {
 func (c *Crontab) AddSchedule(id uint64,
 	minute, hour, dom, month, dow string,
 	cmd func(...interface{}), args ...interface{}) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.cron.addSchedule(id, minute, hour, dom, month, dow, cmd, args...)
 }
 
 func (c *Crontab) AddScheduleByStr(id uint64, str string,
 	cmd func(...interface{}), args ...interface{}) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.cron.addScheduleByStr(id, str, cmd, args...)
 }
 
-func (ctb *Crontab) run(tm int64) {
-	ctb.wg.Add(1)
+// AddJob 添加实现了Job接口的任务，id的规则同AddSchedule。
+func (c *Crontab) AddJob(id uint64, str string, job Job, opts ...JobOption) (uint64, error) {
+	if job == nil {
+		return 0, fmt.Errorf("nil job")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cron.addJob(id, str, job, opts...)
+}
 
-	go func() {
-		const STEP int64 = 60 //最低细粒度60秒，目前只支持到每分钟
-		t := time.Unix(tm, 0)
-		now := time.Now().Unix()
-		diff := tm - now
+// AddAt 添加在at执行一次的任务，执行后自动删除，id的规则同AddSchedule。
+// 以分钟为粒度，at不是整分时在下一个整分执行。
+func (c *Crontab) AddAt(id uint64, at time.Time, job Job, opts ...JobOption) (uint64, error) {
+	if !ceilMinute(at).After(c.Clock().Now()) {
+		return 0, fmt.Errorf("at time has passed:%v", at)
+	}
+	return c.AddJob(id, AtExpr(at), job, opts...)
+}
+
+// AddEvery 添加从startAt开始每隔interval执行一次的任务，id的规则同AddSchedule。
+// interval必须是整分钟，startAt不是整分时从下一个整分开始。
+func (c *Crontab) AddEvery(id uint64, interval time.Duration, startAt time.Time,
+	job Job, opts ...JobOption) (uint64, error) {
+	return c.AddJob(id, EveryExpr(interval, startAt), job, opts...)
+}
+
+// OnError 设置任务返回错误或panic时的回调，回调在执行任务的goroutine中调用。
+// 没有设置时只打日志。
+func (c *Crontab) OnError(f func(id uint64, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks.onError = f
+}
+
+// Update 用新的表达式重新调度任务，id、命令及其它配置不变。
+func (c *Crontab) Update(id uint64, str string) error {
+	return c.modify(id, func() error {
+		return c.cron.update(id, str)
+	})
+}
+
+// SetStore 设置持久化任务的存储，通过AddNamedJob添加的任务的增删改都会保存。
+func (c *Crontab) SetStore(store JobStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cron.store = store
+}
+
+// RegisterHandler 注册持久化任务的命令，恢复任务时通过name找到对应的函数。
+func (c *Crontab) RegisterHandler(name string, cmd func(...interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cron.handlers == nil {
+		c.cron.handlers = make(map[string]func(...interface{}))
+	}
+	c.cron.handlers[name] = cmd
+}
 
-		var d int64 = STEP - int64(t.Second())
-		//fmt.Printf("d:%d\n", d)
-		timer := time.NewTimer(time.Second * time.Duration(d))
+// AddNamedJob 添加需要持久化的任务，handler需要先通过RegisterHandler注册。
+// args会以JSON保存，恢复后数字类型是float64。
+func (c *Crontab) AddNamedJob(id uint64, name, str, handler string,
+	args ...interface{}) (uint64, error) {
+	c.mu.Lock()
+	id, err := c.cron.addNamedJob(id, name, str, handler, args...)
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return id, c.modify(id, func() error { return nil })
+}
+
+// Restore 从存储中恢复任务，停服期间错过的执行按各任务的MisfirePolicy处理。
+// 某个任务恢复失败不影响其它任务，返回遇到的第一个错误。
+// 任务的id被Restore之前添加的非持久化任务占用时，会换成新的id并更新存储，
+// 所以恢复后应通过List或任务名找到任务，不要依赖旧的id。
+func (c *Crontab) Restore() error {
+	c.mu.Lock()
+	store := c.cron.store
+	c.mu.Unlock()
+	if store == nil {
+		return fmt.Errorf("job store not set")
+	}
+
+	recs, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	var ret error
+	var moved []uint64 //换了id的任务的旧id
+	c.mu.Lock()
+	for _, rec := range recs {
+		id, err := c.cron.restore(rec)
+		if err != nil {
+			log.Errorf("crontab restore job %d failed:%v", rec.ID, err)
+			if ret == nil {
+				ret = err
+			}
+			continue
+		}
+		if id != rec.ID {
+			log.Errorf("crontab restore job %d conflicts with an existing job, moved to %d", rec.ID, id)
+			moved = append(moved, rec.ID, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for i := 0; i < len(moved); i += 2 {
+		if err := store.Delete(moved[i]); err != nil && ret == nil {
+			ret = err
+		}
+		if err := c.modify(moved[i+1], func() error { return nil }); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// modify 在锁内执行f，然后保存id对应的持久化任务。
+func (c *Crontab) modify(id uint64, f func() error) error {
+	c.mu.Lock()
+	err := f()
+	store, recs := c.cron.store, c.cron.records(id)
+	c.mu.Unlock()
+
+	if err != nil || store == nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := store.Save(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastRunTime 返回最后处理到的时刻（unix秒），上层可以把它持久化，
+// 重启后通过SetLastRunTime恢复，这样停服期间错过的执行会按各任务的MisfirePolicy处理。
+func (c *Crontab) LastRunTime() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cron.lastRunTime
+}
+
+func (c *Crontab) SetLastRunTime(tm int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cron.lastRunTime = tm
+}
+
+// Pause 暂停任务，暂停期间到期的不会执行，也不会补执行。
+func (c *Crontab) Pause(id uint64) error {
+	return c.modify(id, func() error {
+		return c.cron.setPaused(id, true)
+	})
+}
+
+func (c *Crontab) Resume(id uint64) error {
+	return c.modify(id, func() error {
+		return c.cron.setPaused(id, false)
+	})
+}
+
+// List 返回所有任务的信息，按id排序。
+func (c *Crontab) List() []JobInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cron.list(c.clock.Now())
+}
+
+func (c *Crontab) run() {
+	c.wg.Add(1)
+	clock := c.clock
+	closeC := c.closer.C()
+
+	timer := clock.NewTimer(untilNextMinute(clock.Now()))
+
+	go func() {
+		defer c.wg.Done()
+		defer timer.Stop()
 
 		for {
 			select {
-			case c := <-timer.C:
-				c = c.Add(time.Second * time.Duration(diff))
-				d = STEP - int64(c.Second())
-				//fmt.Printf("d:%d, c:%d\n", d, c.Unix())
-
-				eslen := len(ctb.es)
-				ctb.cron.findJobs(ctb.es, c)
-				if eslen == 0 && len(ctb.es) > 0 {
-					//fmt.Printf("notify %d !\n", len(ctb.es))
-					ctb.C <- struct{}{}
-				}
-
-				timer.Reset(time.Second * time.Duration(d))
-			case <-ctb.C:
-				ctb.wg.Done()
+			case <-timer.C():
+				c.tick(clock.Now())
+
+				timer.Reset(untilNextMinute(clock.Now()))
+			case <-closeC:
 				return
 			}
 		}
 	}()
 }
 
+func (c *Crontab) tick(now time.Time) {
+	c.mu.Lock()
+	eslen := len(c.es)
+	misfires := c.cron.schedule(c.es, now)
+	onMisfire := c.onMisfire
+
+	var recs []*JobRecord
+	store := c.cron.store
+	if store != nil {
+		ids := make([]uint64, 0, len(c.es))
+		for id := range c.es {
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			recs = c.cron.records(ids...)
+		}
+	}
+
+	var runs []pendingRun
+	if c.delivery == DeliverExecute {
+		runs = c.takeRuns(c.es)
+		c.es = make(map[uint64][]time.Time)
+	} else if eslen == 0 && len(c.es) > 0 {
+		select {
+		case c.C <- struct{}{}:
+		default:
+		}
+	}
+	finished := c.cron.sweep(c.es)
+	c.mu.Unlock()
+
+	//只在任务触发时保存，没触发的时刻不影响错过执行的计算
+	for _, rec := range recs {
+		if err := store.Save(rec); err != nil {
+			log.Errorf("crontab save job %d failed:%v", rec.ID, err)
+		}
+	}
+	deleteStored(store, finished)
+	if onMisfire != nil {
+		for _, info := range misfires {
+			onMisfire(info)
+		}
+	}
+
+	//不阻塞计时的goroutine
+	c.execute(runs, true)
+}
+
+// Start 按当前的Clock启动Crontab；如果已经在运行，会先停止再重新启动。
+// 已经到期但还没Process的任务会保留。
+func (c *Crontab) Start() {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.start(nil)
+}
+
+// start 停止上一个run再启动新的，clock不为nil时换成clock，调用者需持有runMu。
+func (c *Crontab) start(clock Clock) {
+	c.mu.Lock()
+	closer := c.closer
+	c.mu.Unlock()
+	closer.Close(nil) //重启不取消任务的ctx
+	c.wg.Wait()       //等待上一个run的关闭，run里的tick需要mu，所以不能持有mu
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if clock != nil {
+		c.clock = clock
+	}
+	c.closer = cls.NewCloseUtil()
+	if c.ctx.Err() != nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+
+	c.run()
+}
+
 // 外部提供一个当前时间戳tm，时间判断是依据该时间戳为基准，而不是标准包的时间；
 // 因为考虑到上层应用可能会有自己的时间系统（不是按标准包的时间）。
-// 调用Run会先停止当前的Crontab，然后再重新启动。若之前有未完成的任务，则会丢弃。
+// 相当于使用NewOffsetClock(tm)作为时钟再Start。
+// 之后再调整时间不必重新Run，调用Clock().(*OffsetClock).SetNow即可。
 func (c *Crontab) Run(tm int64) {
-	//先关闭原来的，再开新的一个。
-	//考虑到上层修改时间重新Run
-	if !c.IsClosed() {
-		c.Close(nil)
-		c.wg.Wait() //等待上一个run的关闭
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.start(NewOffsetClock(tm))
+}
+
+// Process 执行已到期的任务，用于DeliverChannel模式，收到C的通知后调用。
+func (c *Crontab) Process() {
+	c.mu.Lock()
+	runs := c.takeRuns(c.es)
+	c.es = make(map[uint64][]time.Time)
+	store, finished := c.cron.store, c.cron.sweep(c.es)
+	c.mu.Unlock()
+
+	deleteStored(store, finished)
+	c.execute(runs, false)
+}
+
+// deleteStored 从存储中删除已经结束的任务。
+func deleteStored(store JobStore, ids []uint64) {
+	if store == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := store.Delete(id); err != nil {
+			log.Errorf("crontab delete job %d failed:%v", id, err)
+		}
+	}
+}
+
+// pendingRun 是一次待执行的任务，tm为计划时刻。
+type pendingRun struct {
+	e  *Entry
+	tm time.Time
+}
+
+// takeRuns 把es转换成待执行的任务，调用者需持有锁。
+func (c *Crontab) takeRuns(es map[uint64][]time.Time) []pendingRun {
+	runs := make([]pendingRun, 0, len(es))
+	for id, tms := range es {
+		if e := c.cron.entries[id]; e != nil && !e.paused {
+			for _, tm := range tms {
+				runs = append(runs, pendingRun{e, tm})
+			}
+		}
+	}
+	return runs
+}
+
+// execute 按各任务的执行策略执行runs，async为true时全部异步执行。
+// 不持有锁执行，任务里可以调用Crontab的方法。
+func (c *Crontab) execute(runs []pendingRun, async bool) {
+	if len(runs) == 0 {
+		return
 	}
-	c.CloseUtil = cls.MakeCloseUtil()
 
-	c.es = make(map[uint64]struct{})
-	close(c.C)
-	c.C = make(chan struct{}, 10)
+	c.mu.Lock()
+	ctx, clock, h := c.ctx, c.clock, c.hooks
+	c.mu.Unlock()
 
-	c.run(tm)
+	for _, r := range runs {
+		r.e.dispatch(ctx, clock, r.tm, async, &h)
+	}
 }
 
-func (c *Crontab) Process() {
-	for id := range c.es {
-		c.cron.do(id)
+// runAt 立即执行在t这一分钟匹配的任务，不影响正常的调度。
+// 没有指定时区的任务按t自身的时区匹配，与Entry.Test一致。
+func (c *Crontab) runAt(t time.Time) {
+	es := make(map[uint64][]time.Time)
+	c.mu.Lock()
+	c.cron.findJobsIn(es, t, t.Location())
+	runs := c.takeRuns(es)
+	c.mu.Unlock()
+
+	c.execute(runs, false)
+}
+
+// runAll 立即异步执行所有任务，不影响正常的调度。
+func (c *Crontab) runAll() {
+	c.mu.Lock()
+	now := c.clock.Now()
+	runs := make([]pendingRun, 0, len(c.cron.entries))
+	for _, e := range c.cron.entries {
+		if !e.paused {
+			runs = append(runs, pendingRun{e, now})
+		}
 	}
-	c.es = make(map[uint64]struct{})
+	c.mu.Unlock()
+
+	c.execute(runs, true)
+}
+
+func (c *Crontab) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cron.clear()
+}
+
+// Close 停止Crontab，并取消传给任务的ctx。
+func (c *Crontab) Close(cb func()) {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	c.mu.Lock()
+	closer, cancel := c.closer, c.cancel
+	c.mu.Unlock()
+
+	closer.Close(func() {
+		cancel()
+		if cb != nil {
+			cb()
+		}
+	})
+}
+
+// IsClosed 返回Crontab是否已经Close，再次Start后返回false。
+func (c *Crontab) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closer.IsClosed()
+}
+
+// RegisterCloseCallback 注册Close时的回调，重启后需要重新注册。
+func (c *Crontab) RegisterCloseCallback(f func()) {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closer.RegisterCloseCallback(f)
 }
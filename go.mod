@@ -1,6 +1,6 @@
 module github.com/Lei2050/lei-utils
 
-go 1.22.1
+go 1.23
 
 require (
 	github.com/pkg/errors v0.9.1
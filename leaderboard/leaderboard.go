@@ -0,0 +1,246 @@
+// Package leaderboard 是基于skiplist.SortedSet的排行榜。
+//
+// 排名从1开始，1为第一名。分数相同时按TieBreak决定先后，默认先达到该分数的排前面。
+// 设置了MaxSize时，超出的尾部会被自动删除。所有方法都可以并发调用。
+package leaderboard
+
+import (
+	"cmp"
+	"sync"
+	"time"
+
+	"github.com/Lei2050/lei-utils/skiplist"
+)
+
+// TieBreak 决定分数相同时的先后。
+type TieBreak int
+
+const (
+	EarlierFirst TieBreak = iota //先达到该分数的排前面
+	LaterFirst                   //后达到该分数的排前面
+)
+
+type Options struct {
+	MaxSize   uint32           //最多保留的人数，0表示不限
+	Ascending bool             //分数小的排前面，如通关用时
+	TieBreak  TieBreak         //分数相同时的先后
+	Now       func() time.Time //取达到分数的时间，默认time.Now
+}
+
+// Item 是榜上的一项。
+type Item[K cmp.Ordered] struct {
+	Key   K
+	Score int64
+	Rank  uint32
+	At    time.Time //达到该分数的时间
+}
+
+// score 是skiplist中的排序依据，seq区分同一时刻达到相同分数的先后。
+type score struct {
+	value int64
+	at    int64
+	seq   uint64
+}
+
+type Leaderboard[K cmp.Ordered] struct {
+	mu   sync.RWMutex
+	opts Options
+	set  *skiplist.SortedSetFunc[K, score]
+	seq  uint64
+}
+
+func New[K cmp.Ordered](opts Options) *Leaderboard[K] {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	this := &Leaderboard[K]{opts: opts}
+	this.set = skiplist.NewSortedSetFunc(cmp.Compare[K], this.compare)
+	return this
+}
+
+func (this *Leaderboard[K]) compare(a, b score) int {
+	var c int
+	if this.opts.Ascending {
+		c = cmp.Compare(a.value, b.value)
+	} else {
+		c = cmp.Compare(b.value, a.value)
+	}
+	if c != 0 {
+		return c
+	}
+	if c = cmp.Compare(a.at, b.at); c == 0 {
+		c = cmp.Compare(a.seq, b.seq)
+	}
+	if this.opts.TieBreak == LaterFirst {
+		c = -c
+	}
+	return c
+}
+
+func (this *Leaderboard[K]) item(x *skiplist.Node[K, score], rank uint32) Item[K] {
+	s := x.Score()
+	return Item[K]{Key: x.Key(), Score: s.value, Rank: rank, At: time.Unix(0, s.at)}
+}
+
+// update 把key的分数设为value，分数没变时保留原来的达到时间。调用者持有写锁。
+func (this *Leaderboard[K]) update(key K, value int64, at time.Time) uint32 {
+	old, exist := this.set.Score(key)
+	if exist && old.value == value {
+		return this.set.GetRank(key)
+	}
+	this.seq++
+	s := score{value: value, at: at.UnixNano(), seq: this.seq}
+	if exist {
+		this.set.Update(key, s)
+	} else {
+		this.set.Insert(key, s)
+	}
+	this.trim()
+	return this.set.GetRank(key)
+}
+
+func (this *Leaderboard[K]) trim() {
+	if this.opts.MaxSize > 0 && this.set.Length() > this.opts.MaxSize {
+		this.set.DeleteRangeByRank(this.opts.MaxSize+1, this.set.Length())
+	}
+}
+
+// Set 把key的分数设为value，返回排名，因MaxSize没有上榜时返回0。
+func (this *Leaderboard[K]) Set(key K, value int64) uint32 {
+	return this.SetAt(key, value, this.opts.Now())
+}
+
+// SetAt 同Set，达到时间为at。
+func (this *Leaderboard[K]) SetAt(key K, value int64, at time.Time) uint32 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.update(key, value, at)
+}
+
+// SetIfBetter 只在value比原来的分数好时更新，返回排名。
+func (this *Leaderboard[K]) SetIfBetter(key K, value int64) uint32 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if old, exist := this.set.Score(key); exist {
+		if (this.opts.Ascending && value >= old.value) || (!this.opts.Ascending && value <= old.value) {
+			return this.set.GetRank(key)
+		}
+	}
+	return this.update(key, value, this.opts.Now())
+}
+
+// Incr 把key的分数加上delta，不在榜上时从0开始，返回新的分数和排名。
+func (this *Leaderboard[K]) Incr(key K, delta int64) (int64, uint32) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	old, _ := this.set.Score(key)
+	value := old.value + delta
+	return value, this.update(key, value, this.opts.Now())
+}
+
+func (this *Leaderboard[K]) Remove(key K) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.set.Delete(key)
+}
+
+func (this *Leaderboard[K]) Len() uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.Length()
+}
+
+// Rank 返回key的排名，不在榜上时返回0。
+func (this *Leaderboard[K]) Rank(key K) uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.GetRank(key)
+}
+
+func (this *Leaderboard[K]) Get(key K) (Item[K], bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	x := this.set.GetNode(key)
+	if x == nil {
+		return Item[K]{}, false
+	}
+	return this.item(x, this.set.GetRank(key)), true
+}
+
+// rangeByRank 返回排名在[start, end]之间的项。调用者持有读锁。
+func (this *Leaderboard[K]) rangeByRank(start, end uint32) []Item[K] {
+	nodes := this.set.GetRangeByRank(start, end)
+	items := make([]Item[K], 0, len(nodes))
+	for i, x := range nodes {
+		items = append(items, this.item(x, start+uint32(i)))
+	}
+	return items
+}
+
+// Range 返回排名在[start, end]之间的项。
+func (this *Leaderboard[K]) Range(start, end uint32) []Item[K] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.rangeByRank(start, end)
+}
+
+// Top 返回前n名。
+func (this *Leaderboard[K]) Top(n uint32) []Item[K] {
+	return this.Range(1, n)
+}
+
+// Page 返回第page页（从1开始），每页size项，以及总页数。
+func (this *Leaderboard[K]) Page(page, size uint32) ([]Item[K], uint32) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if size == 0 {
+		return nil, 0
+	}
+	pages := (this.set.Length() + size - 1) / size
+	if page == 0 || page > pages {
+		return nil, pages
+	}
+	return this.rangeByRank((page-1)*size+1, page*size), pages
+}
+
+// Around 返回key前后各n名（包括key自己），靠近榜首或榜尾时不足的一侧不补。
+// key不在榜上时返回nil。
+func (this *Leaderboard[K]) Around(key K, n uint32) []Item[K] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	rank := this.set.GetRank(key)
+	if rank == 0 {
+		return nil
+	}
+	start := uint32(1)
+	if rank > n {
+		start = rank - n
+	}
+	end := rank + n
+	if end < rank {
+		end = this.set.Length()
+	}
+	return this.rangeByRank(start, end)
+}
+
+// Snapshot 按排名返回榜上所有项，用于持久化。
+func (this *Leaderboard[K]) Snapshot() []Item[K] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.rangeByRank(1, this.set.Length())
+}
+
+// Restore 清空排行榜并恢复为items，items中分数和达到时间都相同的按items中的顺序排。
+func (this *Leaderboard[K]) Restore(items []Item[K]) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.set.Clear()
+	for _, item := range items {
+		this.seq++
+		s := score{value: item.Score, at: item.At.UnixNano(), seq: this.seq}
+		if !this.set.Insert(item.Key, s) {
+			this.set.Update(item.Key, s)
+		}
+	}
+	this.trim()
+}
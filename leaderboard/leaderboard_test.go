@@ -0,0 +1,136 @@
+package leaderboard
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func keys[K cmp.Ordered](items []Item[K]) []K {
+	ks := make([]K, 0, len(items))
+	for _, item := range items {
+		ks = append(ks, item.Key)
+	}
+	return ks
+}
+
+// fakeNow 每次调用前进一秒。
+func fakeNow() func() time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	lb := New[string](Options{Now: fakeNow()})
+	lb.Set("a", 10)
+	lb.Set("b", 20)
+	lb.Set("c", 10)
+	lb.Set("d", 30)
+	//a先达到10分，排在c前面
+	if ks := keys(lb.Top(10)); !slices.Equal(ks, []string{"d", "b", "a", "c"}) {
+		t.Fatalf("top: %v", ks)
+	}
+	//分数没变，保留原来的达到时间
+	lb.Set("a", 10)
+	if lb.Rank("a") != 3 {
+		t.Fatalf("rank of a: %d", lb.Rank("a"))
+	}
+	if score, rank := lb.Incr("c", 15); score != 25 || rank != 2 {
+		t.Fatalf("incr: %d %d", score, rank)
+	}
+	if rank := lb.SetIfBetter("d", 5); rank != 1 {
+		t.Fatalf("set if better lowered d: %d", rank)
+	}
+	if item, ok := lb.Get("d"); !ok || item.Score != 30 || item.Rank != 1 {
+		t.Fatalf("get d: %+v", item)
+	}
+	if lb.Rank("x") != 0 {
+		t.Fatal("rank of missing key")
+	}
+	if !lb.Remove("d") || lb.Remove("d") || lb.Len() != 3 {
+		t.Fatalf("remove: %d", lb.Len())
+	}
+}
+
+func TestLeaderboardOptions(t *testing.T) {
+	lb := New[int](Options{Now: fakeNow(), Ascending: true, TieBreak: LaterFirst, MaxSize: 3})
+	for i := 1; i <= 5; i++ {
+		lb.Set(i, int64(100-i%2))
+	}
+	//分数小的在前，分数相同时后达到的在前，只保留3个
+	if ks := keys(lb.Top(10)); !slices.Equal(ks, []int{5, 3, 1}) {
+		t.Fatalf("top: %v", ks)
+	}
+	if rank := lb.Set(6, 200); rank != 0 || lb.Len() != 3 {
+		t.Fatalf("trimmed key ranked: %d", rank)
+	}
+	if rank := lb.Set(6, 1); rank != 1 || lb.Rank(1) != 0 {
+		t.Fatalf("rank of 6: %d", rank)
+	}
+}
+
+func TestLeaderboardWindow(t *testing.T) {
+	lb := New[int](Options{Now: fakeNow()})
+	for i := 1; i <= 10; i++ {
+		lb.Set(i, int64(i))
+	}
+	if ks := keys(lb.Around(5, 2)); !slices.Equal(ks, []int{7, 6, 5, 4, 3}) {
+		t.Fatalf("around 5: %v", ks)
+	}
+	if ks := keys(lb.Around(10, 2)); !slices.Equal(ks, []int{10, 9, 8}) {
+		t.Fatalf("around 10: %v", ks)
+	}
+	if items := lb.Around(11, 2); items != nil {
+		t.Fatalf("around missing key: %v", items)
+	}
+
+	items, pages := lb.Page(3, 4)
+	if pages != 3 || !slices.Equal(keys(items), []int{2, 1}) || items[0].Rank != 9 {
+		t.Fatalf("page 3: %v of %d", items, pages)
+	}
+	if items, _ := lb.Page(4, 4); items != nil {
+		t.Fatalf("page 4: %v", items)
+	}
+}
+
+func TestLeaderboardSnapshot(t *testing.T) {
+	lb := New[string](Options{Now: func() time.Time { return time.Unix(100, 0) }})
+	lb.Set("a", 1)
+	lb.Set("b", 1)
+	lb.Set("c", 2)
+	snap := lb.Snapshot()
+
+	restored := New[string](Options{})
+	restored.Set("x", 100)
+	restored.Restore(snap)
+	if got := restored.Snapshot(); !slices.EqualFunc(got, snap, func(a, b Item[string]) bool {
+		return a.Key == b.Key && a.Score == b.Score && a.Rank == b.Rank && a.At.Equal(b.At)
+	}) {
+		t.Fatalf("restored: %v, expect %v", got, snap)
+	}
+}
+
+func TestLeaderboardConcurrent(t *testing.T) {
+	lb := New[int](Options{MaxSize: 50})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				lb.Incr(i%100, int64(g))
+				lb.Around(i%100, 3)
+				lb.Page(2, 10)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if lb.Len() != 50 {
+		t.Fatalf("len: %d", lb.Len())
+	}
+}
@@ -19,3 +19,13 @@ func LCG() uint32 {
 		}
 	}
 }
+
+// NewLCG 返回一个以seed为种子的独立线性同余生成器，相同的seed产生相同的序列。
+// 返回的函数不能并发调用。低位周期很短，需要少量随机位时请取高位。
+func NewLCG(seed uint32) func() uint32 {
+	x := seed
+	return func() uint32 {
+		x = _a*x + _c
+		return x
+	}
+}
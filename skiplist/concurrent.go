@@ -0,0 +1,199 @@
+package skiplist
+
+import (
+	"cmp"
+	"sync"
+)
+
+// Member 是集合元素的拷贝，ConcurrentSortedSet不返回节点，因为节点在解锁后可能被修改。
+type Member[K, S any] struct {
+	Key   K
+	Score S
+}
+
+// ConcurrentSortedSet 是可以并发使用的SortedSetFunc：读操作共享读锁，可以并行；
+// 写操作独占写锁。一次要做很多写操作时用Batch，只加一次锁。
+// 需要多个读操作看到同一个状态时用View；需要长时间读一致的状态又不想阻塞写时用Snapshot。
+type ConcurrentSortedSet[K comparable, S any] struct {
+	mu     sync.RWMutex
+	set    *SortedSetFunc[K, S]
+	shared bool //set被Snapshot返回了，写之前要先复制
+}
+
+func NewConcurrentSortedSetFunc[K comparable, S any](cmpKey func(a, b K) int, cmpScore func(a, b S) int, opts ...Option) *ConcurrentSortedSet[K, S] {
+	return &ConcurrentSortedSet[K, S]{set: NewSortedSetFunc(cmpKey, cmpScore, opts...)}
+}
+
+func NewConcurrentSortedSet[K cmp.Ordered, S cmp.Ordered](opts ...Option) *ConcurrentSortedSet[K, S] {
+	return &ConcurrentSortedSet[K, S]{set: NewSortedSet[K, S](opts...).SortedSetFunc}
+}
+
+// Batch 在一次写锁中执行f，f中不能保留set返回的节点。
+func (this *ConcurrentSortedSet[K, S]) Batch(f func(set *SortedSetFunc[K, S])) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	f(this.set)
+}
+
+// View 在一次读锁中执行f，f中不能修改set，也不能保留set返回的节点。
+func (this *ConcurrentSortedSet[K, S]) View(f func(set *SortedSetFunc[K, S])) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	f(this.set)
+}
+
+// own 在写之前调用，set已经被Snapshot共享时复制一份再写。调用者持有写锁。
+func (this *ConcurrentSortedSet[K, S]) own() {
+	if this.shared {
+		this.set = this.set.Clone()
+		this.shared = false
+	}
+}
+
+// Snapshot 返回当前状态的只读快照，之后的写不影响快照（写时复制：快照后的第一次写在O(n)内复制一次），
+// 快照可以不加锁地并发读，但不能修改。
+func (this *ConcurrentSortedSet[K, S]) Snapshot() *SortedSetFunc[K, S] {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.shared = true
+	return this.set
+}
+
+func members[K, S any](nodes []*Node[K, S]) []Member[K, S] {
+	ms := make([]Member[K, S], 0, len(nodes))
+	for _, x := range nodes {
+		ms = append(ms, Member[K, S]{Key: x.key, Score: x.score})
+	}
+	return ms
+}
+
+func (this *ConcurrentSortedSet[K, S]) Length() uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.Length()
+}
+
+func (this *ConcurrentSortedSet[K, S]) Insert(key K, score S) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.Insert(key, score)
+}
+
+func (this *ConcurrentSortedSet[K, S]) Add(key K, score S, flags AddFlag) (S, bool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.Add(key, score, flags)
+}
+
+func (this *ConcurrentSortedSet[K, S]) IncrBy(key K, delta S) (S, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.IncrBy(key, delta)
+}
+
+func (this *ConcurrentSortedSet[K, S]) Update(key K, score S) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.Update(key, score)
+}
+
+func (this *ConcurrentSortedSet[K, S]) Delete(key K) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.Delete(key)
+}
+
+func (this *ConcurrentSortedSet[K, S]) Score(key K) (S, bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.Score(key)
+}
+
+// GetRank 返回key的排名，从1开始，不存在时返回0。
+func (this *ConcurrentSortedSet[K, S]) GetRank(key K) uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.GetRank(key)
+}
+
+func (this *ConcurrentSortedSet[K, S]) GetRevRank(key K) uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.GetRevRank(key)
+}
+
+// GetByRank 返回排名为rank的元素。
+func (this *ConcurrentSortedSet[K, S]) GetByRank(rank uint32) (Member[K, S], bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if x := this.set.GetNodeByRank(rank); x != nil {
+		return Member[K, S]{Key: x.key, Score: x.score}, true
+	}
+	return Member[K, S]{}, false
+}
+
+func (this *ConcurrentSortedSet[K, S]) GetRangeByRank(start, end uint32) []Member[K, S] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return members(this.set.GetRangeByRank(start, end))
+}
+
+func (this *ConcurrentSortedSet[K, S]) GetRevRangeByRank(start, end uint32) []Member[K, S] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return members(this.set.GetRevRangeByRank(start, end))
+}
+
+func (this *ConcurrentSortedSet[K, S]) GetRangeByScore(rg *Range[S], offset, count int) []Member[K, S] {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return members(this.set.GetRangeByScoreLimit(rg, offset, count))
+}
+
+func (this *ConcurrentSortedSet[K, S]) Count(rg *Range[S]) uint32 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.set.Count(rg)
+}
+
+func (this *ConcurrentSortedSet[K, S]) DeleteRangeByRank(start, end uint32) uint32 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.DeleteRangeByRank(start, end)
+}
+
+func (this *ConcurrentSortedSet[K, S]) DeleteRangeByScore(rg *Range[S]) uint32 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return this.set.DeleteRangeByScore(rg)
+}
+
+func (this *ConcurrentSortedSet[K, S]) PopMin(count int) []Member[K, S] {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return members(this.set.PopMin(count))
+}
+
+func (this *ConcurrentSortedSet[K, S]) PopMax(count int) []Member[K, S] {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.own()
+	return members(this.set.PopMax(count))
+}
+
+// Scan 同SortedSetFunc.Scan，两次Scan之间其他goroutine可以修改集合。
+func (this *ConcurrentSortedSet[K, S]) Scan(cur Cursor[K, S], count int) ([]Member[K, S], Cursor[K, S]) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	nodes, cur := this.set.Scan(cur, count)
+	return members(nodes), cur
+}
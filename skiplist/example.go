@@ -10,10 +10,10 @@ type value struct {
 func (this *value) Key() uint64   { return this.key }
 func (this *value) Score() uint32 { return this.score }
 
-type cmp struct {
+type valueCmp struct {
 }
 
-func (this *cmp) CmpScore(v1 interface{}, v2 interface{}) int {
+func (this *valueCmp) CmpScore(v1 interface{}, v2 interface{}) int {
 	s1 := v1.(*value).score
 	s2 := v2.(*value).score
 	switch {
@@ -26,7 +26,7 @@ func (this *cmp) CmpScore(v1 interface{}, v2 interface{}) int {
 	}
 }
 
-func (this *cmp) CmpKey(v1 interface{}, v2 interface{}) int {
+func (this *valueCmp) CmpKey(v1 interface{}, v2 interface{}) int {
 	s1 := v1.(*value).key
 	s2 := v2.(*value).key
 	switch {
@@ -40,9 +40,9 @@ func (this *cmp) CmpKey(v1 interface{}, v2 interface{}) int {
 }
 
 func Test() {
-	//	ss := NewSet(&cmp{})
+	//	ss := NewSet(&valueCmp{})
 	//  set := make(map[uint64] *value)
-	sl := NewSkipList(&cmp{})
+	sl := NewSkipList(&valueCmp{})
 	var i uint64 = 1
 	for ; i < 100000; i++ {
 		key := &value{
@@ -54,7 +54,7 @@ func Test() {
 		//    ss.Insert(key)
 	}
 	/*
-		ss := NewSet(&cmp{})
+		ss := NewSet(&valueCmp{})
 		key_1 := &value{
 			score: 10,
 			key:   1,
@@ -0,0 +1,147 @@
+package skiplist
+
+import "iter"
+
+// 迭代器在产出元素之前已经取好了下一个节点，所以遍历中删除或修改当前元素是安全的，
+// 遍历会继续到原来的下一个元素；遍历中做其他修改时结果不确定，需要这样做时请用Scan。
+
+// All 从小到大遍历所有元素。
+func (this *List[K, S]) All() iter.Seq2[K, S] {
+	return forward(this.First())
+}
+
+// Backward 从大到小遍历所有元素。
+func (this *List[K, S]) Backward() iter.Seq2[K, S] {
+	return backward(this.Tail())
+}
+
+func forward[K, S any](x *Node[K, S]) iter.Seq2[K, S] {
+	return func(yield func(K, S) bool) {
+		for x != nil {
+			next := x.Next(0)
+			if !yield(x.key, x.score) {
+				return
+			}
+			x = next
+		}
+	}
+}
+
+func backward[K, S any](x *Node[K, S]) iter.Seq2[K, S] {
+	return func(yield func(K, S) bool) {
+		for x != nil {
+			prev := x.Prev()
+			if !yield(x.key, x.score) {
+				return
+			}
+			x = prev
+		}
+	}
+}
+
+// All 从小到大遍历所有元素。
+func (this *SortedSetFunc[K, S]) All() iter.Seq2[K, S] {
+	return this.list.All()
+}
+
+// Backward 从大到小遍历所有元素。
+func (this *SortedSetFunc[K, S]) Backward() iter.Seq2[K, S] {
+	return this.list.Backward()
+}
+
+// FromRank 从排名rank开始（从1开始）从小到大遍历。
+func (this *SortedSetFunc[K, S]) FromRank(rank uint32) iter.Seq2[K, S] {
+	if rank == 0 {
+		rank = 1
+	}
+	return forward(this.list.GetNodeByRank(rank))
+}
+
+// ScoreRange 从小到大遍历score在rg中的元素。
+func (this *SortedSetFunc[K, S]) ScoreRange(rg *Range[S]) iter.Seq2[K, S] {
+	return func(yield func(K, S) bool) {
+		for k, s := range forward(this.FirstInRange(rg)) {
+			if !this.lteMax(s, rg) || !yield(k, s) {
+				return
+			}
+		}
+	}
+}
+
+// Cursor 记录Scan遍历到的位置（最后返回的元素），可以保存下来以后继续遍历。
+// 零值表示从头开始。
+type Cursor[K, S any] struct {
+	Key   K
+	Score S
+	Valid bool
+}
+
+// Scan 从cur之后开始返回最多count个节点，以及下次用的Cursor，返回的节点少于count时表示遍历完了。
+// 两次Scan之间可以任意修改集合：从cur的位置继续，即使cur的元素已经被删除或修改了score；
+// 位置没变的元素不会重复也不会遗漏，在两次Scan之间跨过cur的位置移动的元素可能重复或遗漏。
+func (this *SortedSetFunc[K, S]) Scan(cur Cursor[K, S], count int) ([]*Node[K, S], Cursor[K, S]) {
+	var x *Node[K, S]
+	if cur.Valid {
+		x = this.list.after(cur.Key, cur.Score)
+	} else {
+		x = this.list.First()
+	}
+
+	var nodes []*Node[K, S]
+	for ; x != nil && len(nodes) < count; x = x.Next(0) {
+		nodes = append(nodes, x)
+	}
+	if len(nodes) > 0 {
+		last := nodes[len(nodes)-1]
+		cur = Cursor[K, S]{Key: last.key, Score: last.score, Valid: true}
+	}
+	return nodes, cur
+}
+
+// after 返回第一个排在(key, score)之后的节点。
+func (this *List[K, S]) after(key K, score S) *Node[K, S] {
+	x := this.findUpdate(key, score)[0].Next(0)
+	if x != nil && this.compare(x, key, score) == 0 {
+		x = x.Next(0)
+	}
+	return x
+}
+
+// All 从小到大遍历所有元素，同Range，但可以用for range并提前退出。
+func (this *Set) All() iter.Seq[Valuer] {
+	return setValues(this.sl.All())
+}
+
+// Backward 从大到小遍历所有元素。
+func (this *Set) Backward() iter.Seq[Valuer] {
+	return setValues(this.sl.Backward())
+}
+
+// FromRank 从排名rank开始（从1开始）从小到大遍历。
+func (this *Set) FromRank(rank uint32) iter.Seq[Valuer] {
+	if rank == 0 {
+		rank = 1
+	}
+	return setValues(forward(this.sl.GetNodeByRank(rank)))
+}
+
+// ScoreRange 从小到大遍历score在rg中的元素。
+func (this *Set) ScoreRange(rg *RangeSpec) iter.Seq[Valuer] {
+	return func(yield func(Valuer) bool) {
+		for v := range setValues(forward(this.FirstInRange(rg))) {
+			if !this.ValueLteMax(v.Score(), rg) || !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+func setValues(seq iter.Seq2[interface{}, struct{}]) iter.Seq[Valuer] {
+	return func(yield func(Valuer) bool) {
+		for v := range seq {
+			if !yield(v.(Valuer)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package skiplist
+
+// LexRangeSpec 是key的区间，同ZRANGEBYLEX：MinEx、MaxEx表示不包含边界，
+// MinInf、MaxInf表示该侧没有边界（同Redis的"-"、"+"），此时Min、Max不用。
+// 按key的区间查找要求所有元素的score相同，否则结果没有意义。
+type LexRangeSpec[K any] struct {
+	MinEx, MaxEx   bool
+	MinInf, MaxInf bool
+	Min, Max       K
+}
+
+func (this *SortedSetFunc[K, S]) lexGteMin(key K, rg *LexRangeSpec[K]) bool {
+	if rg.MinInf {
+		return true
+	}
+	if rg.MinEx {
+		return this.list.cmpKey(key, rg.Min) > 0
+	}
+	return this.list.cmpKey(key, rg.Min) >= 0
+}
+
+func (this *SortedSetFunc[K, S]) lexLteMax(key K, rg *LexRangeSpec[K]) bool {
+	if rg.MaxInf {
+		return true
+	}
+	if rg.MaxEx {
+		return this.list.cmpKey(key, rg.Max) < 0
+	}
+	return this.list.cmpKey(key, rg.Max) <= 0
+}
+
+// IsInLexRange 判断集合里是否可能有元素在rg中。
+func (this *SortedSetFunc[K, S]) IsInLexRange(rg *LexRangeSpec[K]) bool {
+	if !rg.MinInf && !rg.MaxInf {
+		c := this.list.cmpKey(rg.Min, rg.Max)
+		if c > 0 || (c == 0 && (rg.MinEx || rg.MaxEx)) {
+			return false
+		}
+	}
+
+	x := this.list.Tail()
+	if x == nil || !this.lexGteMin(x.key, rg) {
+		return false
+	}
+
+	x = this.list.First()
+	if x == nil || !this.lexLteMax(x.key, rg) {
+		return false
+	}
+	return true
+}
+
+// FirstInLexRange 返回rg中的第一个节点，没有时返回nil。
+func (this *SortedSetFunc[K, S]) FirstInLexRange(rg *LexRangeSpec[K]) *Node[K, S] {
+	if !this.IsInLexRange(rg) {
+		return nil
+	}
+
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && !this.lexGteMin(next.key, rg); next = x.Next(i) {
+			x = next
+		}
+	}
+	x = x.Next(0)
+	if !this.lexLteMax(x.key, rg) {
+		return nil
+	}
+	return x
+}
+
+// LastInLexRange 返回rg中的最后一个节点，没有时返回nil。
+func (this *SortedSetFunc[K, S]) LastInLexRange(rg *LexRangeSpec[K]) *Node[K, S] {
+	if !this.IsInLexRange(rg) {
+		return nil
+	}
+
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && this.lexLteMax(next.key, rg); next = x.Next(i) {
+			x = next
+		}
+	}
+	if !this.lexGteMin(x.key, rg) {
+		return nil
+	}
+	return x
+}
+
+// GetRangeByLex 返回key在rg中的节点，跳过前offset个，最多返回count个，count<0表示不限。
+func (this *SortedSetFunc[K, S]) GetRangeByLex(rg *LexRangeSpec[K], offset, count int) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	x := this.FirstInLexRange(rg)
+	if x != nil && offset > 0 {
+		x = this.list.GetNodeByRank(this.list.GetRank(x.key, x.score) + uint32(offset))
+	}
+	for ; x != nil && count != 0 && this.lexLteMax(x.key, rg); x = x.Next(0) {
+		nodes = append(nodes, x)
+		count--
+	}
+	return nodes
+}
+
+// LexCount 返回key在rg中的元素个数，同ZLEXCOUNT。
+func (this *SortedSetFunc[K, S]) LexCount(rg *LexRangeSpec[K]) uint32 {
+	first := this.FirstInLexRange(rg)
+	if first == nil {
+		return 0
+	}
+	last := this.LastInLexRange(rg)
+	return this.list.GetRank(last.key, last.score) - this.list.GetRank(first.key, first.score) + 1
+}
+
+// DeleteRangeByLex 删除key在rg中的元素，返回删除的个数，同ZREMRANGEBYLEX。
+func (this *SortedSetFunc[K, S]) DeleteRangeByLex(rg *LexRangeSpec[K]) uint32 {
+	update := make([]*Node[K, S], int(this.list.Level()))
+	var removed uint32 = 0
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && !this.lexGteMin(next.key, rg); next = x.Next(i) {
+			x = next
+		}
+		update[i] = x
+	}
+	x = x.Next(0)
+	for x != nil && this.lexLteMax(x.key, rg) {
+		next := x.Next(0)
+		this.list.DeleteNode(x, update)
+		delete(this.index, x.key)
+		removed++
+		x = next
+	}
+	return removed
+}
@@ -0,0 +1,344 @@
+package skiplist
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Level 是节点在某一层的后继及到后继的跨度。
+type Level[K, S any] struct {
+	forward *Node[K, S]
+	span    uint32
+}
+
+// Node 是List的节点，按score排序，score相同的按key排序。
+type Node[K, S any] struct {
+	key      K
+	score    S
+	backward *Node[K, S]
+	level    []Level[K, S]
+}
+
+func newNode[K, S any](level int, key K, score S) *Node[K, S] {
+	return &Node[K, S]{
+		key:   key,
+		score: score,
+		level: make([]Level[K, S], level),
+	}
+}
+
+func (this *Node[K, S]) Key() K { return this.key }
+
+func (this *Node[K, S]) Score() S { return this.score }
+
+// Value 同Key，兼容旧的SkipListNode。
+func (this *Node[K, S]) Value() K { return this.key }
+
+func (this *Node[K, S]) Next(i int) *Node[K, S] { return this.level[i].forward }
+
+func (this *Node[K, S]) SetNext(i int, next *Node[K, S]) { this.level[i].forward = next }
+
+func (this *Node[K, S]) Span(i int) uint32 { return this.level[i].span }
+
+func (this *Node[K, S]) SetSpan(i int, span uint32) { this.level[i].span = span }
+
+func (this *Node[K, S]) Prev() *Node[K, S] { return this.backward }
+
+// List 是带跨度的跳表（同Redis的zskiplist），元素为(key, score)，
+// 先按cmpScore再按cmpKey排序，可以按排名查找。
+// SkipList这个名字保留给旧的基于interface{}的接口。
+type List[K, S any] struct {
+	head, tail    *Node[K, S]
+	length, level uint32
+	cmpKey        func(a, b K) int
+	cmpScore      func(a, b S) int
+	cfg           config
+	alloc         allocator[K, S]
+}
+
+func NewList[K, S any](cmpKey func(a, b K) int, cmpScore func(a, b S) int, opts ...Option) *List[K, S] {
+	cfg := config{p: SKIPLIST_P, maxLevel: SKIPLIST_MAXLEVEL, rand: rand.Uint32}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newList(cmpKey, cmpScore, cfg)
+}
+
+func newList[K, S any](cmpKey func(a, b K) int, cmpScore func(a, b S) int, cfg config) *List[K, S] {
+	var key K
+	var score S
+	return &List[K, S]{
+		head:     newNode(1, key, score),
+		level:    1,
+		cmpKey:   cmpKey,
+		cmpScore: cmpScore,
+		cfg:      cfg,
+		alloc:    allocator[K, S]{arena: cfg.arena, freeList: cfg.freeList, separate: cfg.separate},
+	}
+}
+
+// empty 返回比较函数和选项都相同的空表。
+func (this *List[K, S]) empty() *List[K, S] {
+	return newList(this.cmpKey, this.cmpScore, this.cfg)
+}
+
+func (this *List[K, S]) Level() uint32 { return this.level }
+
+func (this *List[K, S]) Length() uint32 { return this.length }
+
+func (this *List[K, S]) Head() *Node[K, S] { return this.head }
+
+func (this *List[K, S]) Tail() *Node[K, S] { return this.tail }
+
+func (this *List[K, S]) First() *Node[K, S] { return this.head.Next(0) }
+
+// compare 比较节点x与(key, score)的先后。
+func (this *List[K, S]) compare(x *Node[K, S], key K, score S) int {
+	if c := this.cmpScore(x.score, score); c != 0 {
+		return c
+	}
+	return this.cmpKey(x.key, key)
+}
+
+// randomLevel 返回新节点的层数，每多一层的概率为p。LCG的低位随机性差，所以取高16位。
+func (this *List[K, S]) randomLevel() int {
+	level := 1
+	threshold := uint32(this.cfg.p * 0xFFFF)
+	for (this.cfg.rand()>>16) < threshold && level < this.cfg.maxLevel {
+		level++
+	}
+	return level
+}
+
+// Insert 插入(key, score)，不检查是否已经存在。
+func (this *List[K, S]) Insert(key K, score S) *Node[K, S] {
+	x := this.alloc.alloc(this.randomLevel(), key, score)
+	this.insertNode(x)
+	return x
+}
+
+// insertNode 按x的key、score插入节点x，层数为x已有的层数。
+func (this *List[K, S]) insertNode(x *Node[K, S]) {
+	key, score := x.key, x.score
+	var update [SKIPLIST_MAXLEVEL]*Node[K, S]
+	var rank [SKIPLIST_MAXLEVEL]uint32
+	p := this.head
+	for i := int(this.level - 1); i >= 0; i-- {
+		if i == int(this.level-1) {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+
+		for next := p.Next(i); next != nil && this.compare(next, key, score) < 0; next = p.Next(i) {
+			rank[i] += p.Span(i)
+			p = next
+		}
+		update[i] = p
+	}
+
+	level := uint32(len(x.level))
+
+	if level > this.level {
+		this.growHead(int(level))
+		for i := this.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = this.head
+			update[i].SetSpan(int(i), this.length)
+		}
+		this.level = level
+	}
+
+	for i := 0; i < int(level); i++ {
+		x.SetNext(i, update[i].Next(i))
+		update[i].SetNext(i, x)
+
+		x.SetSpan(i, update[i].Span(i)-(rank[0]-rank[i]))
+		update[i].SetSpan(i, rank[0]-rank[i]+1)
+	}
+
+	for i := level; i < this.level; i++ {
+		update[i].SetSpan(int(i), update[i].Span(int(i))+1)
+	}
+
+	if update[0] == this.head {
+		x.backward = nil
+	} else {
+		x.backward = update[0]
+	}
+
+	if x.Next(0) != nil {
+		x.Next(0).backward = x
+	} else {
+		this.tail = x
+	}
+	this.length++
+}
+
+// growHead 保证头节点至少有level层，头节点的层数按需增长，不一开始就分配最大层数。
+func (this *List[K, S]) growHead(level int) {
+	for len(this.head.level) < level {
+		this.head.level = append(this.head.level, Level[K, S]{})
+	}
+}
+
+// DeleteNode 删除节点x，update为各层中x的前驱。
+// 启用了WithFreeList时x会被复用，调用者在下一次插入之前用完x。
+func (this *List[K, S]) DeleteNode(x *Node[K, S], update []*Node[K, S]) {
+	this.unlink(x, update)
+	this.alloc.release(x)
+}
+
+// unlink 把x从跳表中摘下来，不回收。
+func (this *List[K, S]) unlink(x *Node[K, S], update []*Node[K, S]) {
+	for i := 0; i < int(this.level); i++ {
+		if update[i].Next(i) == x {
+			update[i].SetSpan(i, update[i].Span(i)+x.Span(i)-1)
+			update[i].SetNext(i, x.Next(i))
+		} else {
+			update[i].SetSpan(i, update[i].Span(i)-1)
+		}
+	}
+
+	if x.Next(0) != nil {
+		x.Next(0).backward = x.backward
+	} else {
+		this.tail = x.backward
+	}
+
+	for this.level > 1 && this.head.Next(int(this.level-1)) == nil {
+		this.level--
+	}
+	this.length--
+}
+
+// findUpdate 返回各层中最后一个排在(key, score)之前的节点。
+func (this *List[K, S]) findUpdate(key K, score S) []*Node[K, S] {
+	update := make([]*Node[K, S], int(this.level))
+	x := this.head
+	for i := int(this.level - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && this.compare(next, key, score) < 0; next = x.Next(i) {
+			x = next
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// Delete 删除(key, score)，不存在时返回nil。
+func (this *List[K, S]) Delete(key K, score S) *Node[K, S] {
+	update := this.findUpdate(key, score)
+	x := update[0].Next(0)
+	if x != nil && this.compare(x, key, score) == 0 {
+		this.DeleteNode(x, update)
+		return x
+	}
+	return nil
+}
+
+// UpdateScore 把(key, score)的score改为newScore，返回节点，不存在时返回nil。
+// 同Redis的zslUpdateScore，排序不变时原地修改，否则移动节点，节点本身不变。
+func (this *List[K, S]) UpdateScore(key K, score S, newScore S) *Node[K, S] {
+	update := this.findUpdate(key, score)
+	x := update[0].Next(0)
+	if x == nil || this.compare(x, key, score) != 0 {
+		return nil
+	}
+	x.score = newScore
+	this.reposition(x, update)
+	return x
+}
+
+// reposition 在x的key或score改变后把x移到正确的位置，update为x改变前各层的前驱。
+func (this *List[K, S]) reposition(x *Node[K, S], update []*Node[K, S]) {
+	if (x.backward == nil || this.compare(x.backward, x.key, x.score) < 0) &&
+		(x.Next(0) == nil || this.compare(x.Next(0), x.key, x.score) > 0) {
+		return
+	}
+	this.unlink(x, update)
+	x.backward = nil
+	for i := range x.level {
+		x.level[i] = Level[K, S]{}
+	}
+	this.insertNode(x)
+}
+
+// DeleteRangeByRank 删除排名在[start, end]之间的节点（排名从1开始），
+// 每删除一个调用一次deleted，返回删除的个数。
+func (this *List[K, S]) DeleteRangeByRank(start, end uint32, deleted func(x *Node[K, S])) uint32 {
+	update := make([]*Node[K, S], int(this.level))
+	var removed uint32 = 0
+	var traversed uint32 = 0
+	x := this.head
+	for i := int(this.level - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil &&
+			x.Span(i)+traversed < start; next = x.Next(i) {
+			traversed += x.Span(i)
+			x = next
+		}
+		update[i] = x
+	}
+	x = x.Next(0)
+	traversed++
+	for x != nil && traversed <= end {
+		next := x.Next(0)
+		this.DeleteNode(x, update)
+		if deleted != nil {
+			deleted(x)
+		}
+		removed++
+		traversed++
+		x = next
+	}
+	return removed
+}
+
+// GetRank 返回(key, score)的排名，排名从1开始，不存在时返回0。
+func (this *List[K, S]) GetRank(key K, score S) uint32 {
+	var rank uint32 = 0
+	x := this.head
+	for i := int(this.level - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && this.compare(next, key, score) <= 0; next = x.Next(i) {
+			rank += x.Span(i)
+			x = next
+		}
+		if x != this.head && this.compare(x, key, score) == 0 {
+			return rank
+		}
+	}
+	return 0
+}
+
+// GetNodeByRank 返回排名为rank的节点，排名从1开始。
+func (this *List[K, S]) GetNodeByRank(rank uint32) *Node[K, S] {
+	x := this.head
+	var traversed uint32 = 0
+	for i := int(this.level - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil &&
+			traversed+x.Span(i) <= rank; next = x.Next(i) {
+			traversed += x.Span(i)
+			x = next
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func (this *List[K, S]) Dump() {
+	fmt.Println("*************SKIP LIST DUMP START*************")
+	for i := int(this.level - 1); i >= 0; i-- {
+		fmt.Printf("level:--------%v--------\n", i)
+		x := this.head
+		for x != nil {
+			if x == this.head {
+				fmt.Printf("Head span: %v\n", x.Span(i))
+			} else {
+				fmt.Printf("span: %v key: %v score: %v\n", x.Span(i), x.key, x.score)
+			}
+			x = x.Next(i)
+		}
+	}
+	fmt.Println("*************SKIP LIST DUMP END*************")
+}
@@ -0,0 +1,106 @@
+package skiplist
+
+// 节点的内存布局：
+//   层数不超过4的节点（p=0.25时超过99%）把层数组和节点放在同一次分配里，每次插入只分配一次；
+//   层数更多的节点单独分配层数组。
+//   WithArena时节点从成块分配的slab中取，摊下来每次插入几乎不分配，但同一块中只要还有节点在用，整块都不会释放。
+//   WithFreeList时删除的节点放到按层数分的空闲链表中，插入时优先复用。
+
+const arenaChunk = 256
+
+type node1[K, S any] struct {
+	Node[K, S]
+	levels [1]Level[K, S]
+}
+
+type node2[K, S any] struct {
+	Node[K, S]
+	levels [2]Level[K, S]
+}
+
+type node3[K, S any] struct {
+	Node[K, S]
+	levels [3]Level[K, S]
+}
+
+type node4[K, S any] struct {
+	Node[K, S]
+	levels [4]Level[K, S]
+}
+
+type allocator[K, S any] struct {
+	arena, freeList bool
+	separate        bool //旧的布局：层数组总是单独分配，只用于对比测试
+	slab1           []node1[K, S]
+	slab2           []node2[K, S]
+	slab3           []node3[K, S]
+	slab4           []node4[K, S]
+	levels          []Level[K, S]
+	free            [SKIPLIST_MAXLEVEL + 1][]*Node[K, S]
+}
+
+func take[T any](slab *[]T, arena bool) *T {
+	if !arena {
+		return new(T)
+	}
+	if len(*slab) == 0 {
+		*slab = make([]T, arenaChunk)
+	}
+	x := &(*slab)[0]
+	*slab = (*slab)[1:]
+	return x
+}
+
+func (this *allocator[K, S]) alloc(level int, key K, score S) *Node[K, S] {
+	if free := this.free[level]; len(free) > 0 {
+		x := free[len(free)-1]
+		this.free[level] = free[:len(free)-1]
+		clear(x.level)
+		x.key, x.score, x.backward = key, score, nil
+		return x
+	}
+
+	var x *Node[K, S]
+	switch {
+	case this.separate:
+		return newNode(level, key, score)
+	case level == 1:
+		n := take(&this.slab1, this.arena)
+		n.level = n.levels[:]
+		x = &n.Node
+	case level == 2:
+		n := take(&this.slab2, this.arena)
+		n.level = n.levels[:]
+		x = &n.Node
+	case level == 3:
+		n := take(&this.slab3, this.arena)
+		n.level = n.levels[:]
+		x = &n.Node
+	case level == 4:
+		n := take(&this.slab4, this.arena)
+		n.level = n.levels[:]
+		x = &n.Node
+	default:
+		x = new(Node[K, S])
+		if this.arena {
+			if len(this.levels) < level {
+				this.levels = make([]Level[K, S], max(arenaChunk, level))
+			}
+			x.level = this.levels[:level:level]
+			this.levels = this.levels[level:]
+		} else {
+			x.level = make([]Level[K, S], level)
+		}
+	}
+	x.key, x.score = key, score
+	return x
+}
+
+// release 回收已经从跳表中删除的节点x。
+func (this *allocator[K, S]) release(x *Node[K, S]) {
+	if !this.freeList {
+		return
+	}
+	//不清空key、score，调用者在下一次插入之前还可以读
+	this.free[len(x.level)] = append(this.free[len(x.level)], x)
+}
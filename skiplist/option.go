@@ -0,0 +1,70 @@
+package skiplist
+
+import (
+	"math/rand"
+
+	"github.com/Lei2050/lei-utils/random"
+)
+
+type config struct {
+	p        float32
+	maxLevel int
+	rand     func() uint32
+	arena    bool
+	freeList bool
+	separate bool
+}
+
+// Option 是创建跳表时的选项，默认p为SKIPLIST_P，最大层数为SKIPLIST_MAXLEVEL，随机数用math/rand。
+type Option func(cfg *config)
+
+// WithP 设置每多一层的概率，p要在(0, 1)之间，否则不生效。
+func WithP(p float32) Option {
+	return func(cfg *config) {
+		if p > 0 && p < 1 {
+			cfg.p = p
+		}
+	}
+}
+
+// WithMaxLevel 设置最大层数，在[1, SKIPLIST_MAXLEVEL]之间，超出时取边界值。
+func WithMaxLevel(level int) Option {
+	return func(cfg *config) {
+		cfg.maxLevel = min(max(level, 1), SKIPLIST_MAXLEVEL)
+	}
+}
+
+// WithRand 设置随机数来源，比如random.LCG。跳表不加锁调用它，多个跳表并发使用同一个来源时它要是并发安全的。
+func WithRand(rand func() uint32) Option {
+	return func(cfg *config) {
+		if rand != nil {
+			cfg.rand = rand
+		}
+	}
+}
+
+// WithSeed 使用以seed为种子的独立随机数来源，相同的seed和相同的操作得到相同的结构，用于测试复现。
+func WithSeed(seed int64) Option {
+	return WithRand(rand.New(rand.NewSource(seed)).Uint32)
+}
+
+// WithLCG 使用以seed为种子的独立线性同余生成器，比WithSeed快。
+func WithLCG(seed uint32) Option {
+	return WithRand(random.NewLCG(seed))
+}
+
+// WithArena 从成块分配的slab中分配节点，减少分配次数和GC扫描的对象数，
+// 代价是同一块中只要还有节点在用，整块都不会释放。适合只增不减或者整体丢弃的大表。
+func WithArena() Option {
+	return func(cfg *config) {
+		cfg.arena = true
+	}
+}
+
+// WithFreeList 复用删除的节点。启用后不能保留已经删除的节点，
+// 包括DeleteRangeByRank的回调参数和PopMin、PopMax的返回值，在下一次插入之前要用完。
+func WithFreeList() Option {
+	return func(cfg *config) {
+		cfg.freeList = true
+	}
+}
@@ -1,5 +1,10 @@
 package skiplist
 
+import (
+	"fmt"
+	"io"
+)
+
 type Valuer interface {
 	Key() uint64
 	Score() uint64
@@ -10,9 +15,9 @@ type Set struct {
 	index map[uint64]Valuer
 }
 
-func NewSet(cmp Comparatorer) *Set {
+func NewSet(cmp Comparatorer, opts ...Option) *Set {
 	return &Set{
-		sl:    NewSkipList(cmp),
+		sl:    NewSkipList(cmp, opts...),
 		index: make(map[uint64]Valuer),
 	}
 }
@@ -25,10 +30,42 @@ func (this *Set) Tail() *SkipListNode { return this.sl.Tail() }
 
 func (this *Set) First() *SkipListNode { return this.sl.First() }
 
-//Insert之前检查element是否存在(GetElement)
-func (this *Set) Insert(value Valuer) {
+// Insert 插入value，key已经存在时不插入并返回false。
+// 插入后不要直接修改value的score，要用Update。
+func (this *Set) Insert(value Valuer) bool {
+	if _, exist := this.index[value.Key()]; exist {
+		return false
+	}
 	this.sl.Insert(value)
 	this.index[value.Key()] = value
+	return true
+}
+
+// ScoreSetter 是可以用Set.Update修改score的Valuer。
+type ScoreSetter interface {
+	Valuer
+	SetScore(score uint64)
+}
+
+// Update 把key的score改为score，同时调用value的SetScore，value需要实现ScoreSetter。
+// 排序不变时原地修改，否则移动节点。
+func (this *Set) Update(key uint64, score uint64) error {
+	value, exist := this.index[key]
+	if !exist {
+		return fmt.Errorf("key %d not found", key)
+	}
+	setter, ok := value.(ScoreSetter)
+	if !ok {
+		return fmt.Errorf("value of key %d does not implement ScoreSetter", key)
+	}
+	update := this.sl.findUpdate(value, struct{}{})
+	x := update[0].Next(0)
+	if x == nil || x.key.(Valuer).Key() != key {
+		return fmt.Errorf("value of key %d not in list, score changed outside Update?", key)
+	}
+	setter.SetScore(score)
+	this.sl.reposition(x, update)
+	return nil
 }
 
 func (this *Set) GetElement(key uint64) Valuer {
@@ -55,30 +92,9 @@ func (this *Set) GetNodeByRank(rank uint32) *SkipListNode {
 }
 
 func (this *Set) DeleteRangeByRank(start, end uint32) uint32 {
-	level := int(this.sl.Level())
-	update := make([]*SkipListNode, level)
-	var removed uint32 = 0
-	var traversed uint32 = 0
-	x := this.sl.Head()
-	for i := level - 1; i >= 0; i-- {
-		for next := x.Next(i); next != nil &&
-			x.Span(i)+traversed < start; next = x.Next(i) {
-			traversed += x.Span(i)
-			x = next
-		}
-		update[i] = x
-	}
-	x = x.Next(0)
-	traversed++
-	for x != nil && traversed <= end {
-		next := x.Next(0)
-		this.sl.DeleteNode(x, update)
+	return this.sl.DeleteRangeByRank(start, end, func(x *SkipListNode) {
 		delete(this.index, x.Value().(Valuer).Key())
-		removed++
-		traversed++
-		x = next
-	}
-	return removed
+	})
 }
 
 func (this *Set) Dump() {
@@ -212,7 +228,7 @@ func (this *Set) GetRangeByScore(rg *RangeSpec) []interface{} {
 		if !this.ValueLteMax(x.Value().(Valuer).Score(), rg) {
 			break
 		}
-		values = append(values, x.value)
+		values = append(values, x.Value())
 		x = x.Next(0)
 	}
 	return values
@@ -223,3 +239,68 @@ func (this *Set) Range(f func(interface{})) {
 		f(tmp.Value())
 	}
 }
+
+// Load 用按排名排好序的values在O(n)内建表，Set必须是空的。
+func (this *Set) Load(values []Valuer) error {
+	if this.Length() != 0 {
+		return fmt.Errorf("load into non-empty set")
+	}
+	for i := 1; i < len(values); i++ {
+		if this.sl.cmpKey(values[i-1], values[i]) >= 0 {
+			return fmt.Errorf("values not sorted or duplicated at %d", i)
+		}
+	}
+	for _, v := range values {
+		if _, exist := this.index[v.Key()]; exist {
+			this.index = make(map[uint64]Valuer)
+			return fmt.Errorf("duplicate key %d", v.Key())
+		}
+		this.index[v.Key()] = v
+	}
+
+	i := 0
+	this.sl.appendSorted(func() (interface{}, struct{}, bool) {
+		if i == len(values) {
+			return nil, struct{}{}, false
+		}
+		i++
+		return values[i-1], struct{}{}, true
+	})
+	return nil
+}
+
+// Records 按排名返回所有元素的key、score，payload不为nil时用它取每个元素附带的数据。
+func (this *Set) Records(payload func(value Valuer) []byte) []Record[uint64, uint64] {
+	records := make([]Record[uint64, uint64], 0, this.Length())
+	for v := range this.All() {
+		r := Record[uint64, uint64]{Key: v.Key(), Score: v.Score()}
+		if payload != nil {
+			r.Payload = payload(v)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// LoadRecords 用newValue把records还原成Valuer后Load。
+func (this *Set) LoadRecords(records []Record[uint64, uint64], newValue func(r Record[uint64, uint64]) Valuer) error {
+	values := make([]Valuer, 0, len(records))
+	for _, r := range records {
+		values = append(values, newValue(r))
+	}
+	return this.Load(values)
+}
+
+// EncodeBinary 同SortedSetFunc.EncodeBinary。
+func (this *Set) EncodeBinary(w io.Writer, payload func(value Valuer) []byte) error {
+	return writeRecords(w, this.Records(payload), payload != nil)
+}
+
+// DecodeBinary 读取EncodeBinary写的快照，用newValue还原成Valuer后Load。
+func (this *Set) DecodeBinary(r io.Reader, newValue func(r Record[uint64, uint64]) Valuer) error {
+	records, err := readRecords[uint64, uint64](r)
+	if err != nil {
+		return err
+	}
+	return this.LoadRecords(records, newValue)
+}
@@ -0,0 +1,909 @@
+package skiplist
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Lei2050/lei-utils/random"
+)
+
+// checkList 检查跳表结构是否正确。
+func checkList[K, S any](t *testing.T, l *List[K, S]) {
+	t.Helper()
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type member struct {
+	key, score uint64
+}
+
+func (this *member) Key() uint64   { return this.key }
+func (this *member) Score() uint64 { return this.score }
+
+type memberCmp struct{}
+
+func (memberCmp) CmpScore(v1, v2 interface{}) int {
+	return cmp.Compare(v1.(*member).score, v2.(*member).score)
+}
+
+func (memberCmp) CmpKey(v1, v2 interface{}) int {
+	return cmp.Compare(v1.(*member).key, v2.(*member).key)
+}
+
+func TestSetCompat(t *testing.T) {
+	set := NewSet(memberCmp{})
+	for i := uint64(1); i <= 100; i++ {
+		set.Insert(&member{key: i, score: i % 10})
+	}
+	checkList(t, set.sl.List)
+	if set.Length() != 100 {
+		t.Fatalf("length %d", set.Length())
+	}
+	//score相同按key排序
+	if rank := set.GetRank(10); rank != 1 {
+		t.Fatalf("rank of 10: %d", rank)
+	}
+	if rank := set.sl.GetRank(set.GetElement(20)); rank != 2 {
+		t.Fatalf("skiplist rank of 20: %d", rank)
+	}
+	if v := set.GetNodeByRank(2).Value().(Valuer); v.Key() != 20 {
+		t.Fatalf("rank 2: %v", v.Key())
+	}
+	if n := len(set.GetRangeByScore(&RangeSpec{Min: 3, Max: 4})); n != 20 {
+		t.Fatalf("range by score: %d", n)
+	}
+	if n := set.DeleteRangeByScore(&RangeSpec{Min: 3, Max: 4}); n != 20 || set.GetElement(3) != nil {
+		t.Fatalf("delete range by score: %d", n)
+	}
+	if n := set.DeleteRangeByRank(1, 10); n != 10 || set.GetElement(10) != nil {
+		t.Fatalf("delete range by rank: %d", n)
+	}
+	set.Delete(set.GetElement(11))
+	checkList(t, set.sl.List)
+	if set.Length() != 69 {
+		t.Fatalf("length %d", set.Length())
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	set := NewSortedSet[int, int]()
+	ref := make(map[int]int)
+	for i := 0; i < 2000; i++ {
+		key, score := rand.Intn(500), rand.Intn(100)
+		if _, exist := ref[key]; exist {
+			if set.Insert(key, score) {
+				t.Fatalf("duplicate key %d inserted", key)
+			}
+			set.Delete(key)
+			delete(ref, key)
+			continue
+		}
+		set.Insert(key, score)
+		ref[key] = score
+	}
+	checkList(t, set.list)
+
+	keys := make([]int, 0, len(ref))
+	for key := range ref {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b int) int {
+		if c := cmp.Compare(ref[a], ref[b]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	if int(set.Length()) != len(keys) {
+		t.Fatalf("length %d, expect %d", set.Length(), len(keys))
+	}
+	for i, key := range keys {
+		if rank := set.GetRank(key); rank != uint32(i+1) {
+			t.Fatalf("rank of %d: %d, expect %d", key, rank, i+1)
+		}
+		if x := set.GetNodeByRank(uint32(i + 1)); x.Key() != key {
+			t.Fatalf("rank %d: %d, expect %d", i+1, x.Key(), key)
+		}
+	}
+
+	rg := &Range[int]{Min: 20, Max: 30, MaxEx: true}
+	var inRange int
+	for _, score := range ref {
+		if score >= 20 && score < 30 {
+			inRange++
+		}
+	}
+	if nodes := set.GetRangeByScore(rg); len(nodes) != inRange {
+		t.Fatalf("range by score: %d, expect %d", len(nodes), inRange)
+	}
+	if n := set.DeleteRangeByScore(rg); int(n) != inRange {
+		t.Fatalf("delete range by score: %d, expect %d", n, inRange)
+	}
+	if set.FirstInRange(rg) != nil {
+		t.Fatal("range not deleted")
+	}
+	set.DeleteRangeByRank(1, 10)
+	checkList(t, set.list)
+	if int(set.Length()) != len(keys)-inRange-10 || len(set.index) != int(set.Length()) {
+		t.Fatalf("length %d, index %d", set.Length(), len(set.index))
+	}
+}
+
+func nodeKeys[K, S any](nodes []*Node[K, S]) []K {
+	keys := make([]K, 0, len(nodes))
+	for _, x := range nodes {
+		keys = append(keys, x.Key())
+	}
+	return keys
+}
+
+func TestSortedSetZAdd(t *testing.T) {
+	set := NewSortedSet[string, int]()
+	if _, ok, _ := set.Add("a", 1, AddXX); ok || set.Length() != 0 {
+		t.Fatal("XX added new key")
+	}
+	if _, ok, _ := set.Add("a", 1, 0); !ok {
+		t.Fatal("a not added")
+	}
+	if score, ok, _ := set.Add("a", 5, AddNX); ok || score != 1 {
+		t.Fatalf("NX updated: %d", score)
+	}
+	if score, ok, _ := set.Add("a", 0, AddGT); ok || score != 1 {
+		t.Fatalf("GT lowered: %d", score)
+	}
+	if score, ok, _ := set.Add("a", 3, AddGT|AddXX); !ok || score != 3 {
+		t.Fatalf("GT: %d", score)
+	}
+	if score, ok, _ := set.Add("a", 4, AddLT); ok || score != 3 {
+		t.Fatalf("LT raised: %d", score)
+	}
+	if score, ok, _ := set.Add("a", 2, AddIncr); !ok || score != 5 {
+		t.Fatalf("INCR: %d", score)
+	}
+	if _, _, err := set.Add("a", 1, AddNX|AddGT); err == nil {
+		t.Fatal("NX|GT accepted")
+	}
+	if _, _, err := set.Add("a", 1, AddGT|AddLT); err == nil {
+		t.Fatal("GT|LT accepted")
+	}
+	if score, _ := set.IncrBy("b", 7); score != 7 {
+		t.Fatalf("IncrBy new key: %d", score)
+	}
+	if score, _ := set.IncrBy("a", -4); score != 1 || set.GetRank("a") != 1 {
+		t.Fatalf("IncrBy: %d, rank %d", score, set.GetRank("a"))
+	}
+	checkList(t, set.list)
+
+	fset := NewSortedSetFunc(cmp.Compare[string], cmp.Compare[int])
+	if _, err := fset.IncrBy("a", 1); err == nil {
+		t.Fatal("IncrBy without add func")
+	}
+	fset.SetAddFunc(func(a, b int) int { return a + b })
+	if score, _ := fset.IncrBy("a", 1); score != 1 {
+		t.Fatalf("IncrBy with add func: %d", score)
+	}
+}
+
+func TestSortedSetZRange(t *testing.T) {
+	set := NewSortedSet[int, int]()
+	for i := 1; i <= 10; i++ {
+		set.Insert(i, i*10)
+	}
+	if rank := set.GetRevRank(10); rank != 1 {
+		t.Fatalf("rev rank of 10: %d", rank)
+	}
+	if rank := set.GetRevRank(11); rank != 0 {
+		t.Fatalf("rev rank of 11: %d", rank)
+	}
+	if keys := nodeKeys(set.GetRevRangeByRank(2, 4)); !slices.Equal(keys, []int{9, 8, 7}) {
+		t.Fatalf("rev range by rank: %v", keys)
+	}
+	if keys := nodeKeys(set.GetRevRangeByRank(9, 20)); !slices.Equal(keys, []int{2, 1}) {
+		t.Fatalf("rev range by rank past end: %v", keys)
+	}
+
+	rg := &Range[int]{Min: 20, Max: 80, MinEx: true}
+	if n := set.Count(rg); n != 6 {
+		t.Fatalf("count: %d", n)
+	}
+	if n := set.Count(&Range[int]{Min: 101, Max: 200}); n != 0 {
+		t.Fatalf("count out of range: %d", n)
+	}
+	if keys := nodeKeys(set.GetRangeByScoreLimit(rg, 2, 3)); !slices.Equal(keys, []int{5, 6, 7}) {
+		t.Fatalf("range by score limit: %v", keys)
+	}
+	if keys := nodeKeys(set.GetRangeByScoreLimit(rg, 4, -1)); !slices.Equal(keys, []int{7, 8}) {
+		t.Fatalf("range by score offset: %v", keys)
+	}
+	if keys := nodeKeys(set.GetRangeByScoreLimit(rg, 6, -1)); len(keys) != 0 {
+		t.Fatalf("range by score offset past end: %v", keys)
+	}
+	if keys := nodeKeys(set.GetRevRangeByScore(rg, 1, 2)); !slices.Equal(keys, []int{7, 6}) {
+		t.Fatalf("rev range by score: %v", keys)
+	}
+	if keys := nodeKeys(set.GetRevRangeByScore(rg, 0, -1)); !slices.Equal(keys, []int{8, 7, 6, 5, 4, 3}) {
+		t.Fatalf("rev range by score all: %v", keys)
+	}
+
+	if keys := nodeKeys(set.PopMin(2)); !slices.Equal(keys, []int{1, 2}) {
+		t.Fatalf("pop min: %v", keys)
+	}
+	if keys := nodeKeys(set.PopMax(2)); !slices.Equal(keys, []int{10, 9}) {
+		t.Fatalf("pop max: %v", keys)
+	}
+	if set.Length() != 6 || set.GetNode(1) != nil || set.GetNode(10) != nil {
+		t.Fatalf("length after pop: %d", set.Length())
+	}
+	checkList(t, set.list)
+}
+
+func TestSortedSetStore(t *testing.T) {
+	a, b := NewSortedSet[string, float64](), NewSortedSet[string, float64]()
+	a.Insert("x", 1)
+	a.Insert("y", 2)
+	b.Insert("y", 3)
+	b.Insert("z", 4)
+
+	dst := NewSortedSet[string, float64]()
+	dst.Insert("old", 100)
+	if n, _ := UnionStore(dst, []*SortedSet[string, float64]{a, b}, []float64{2, 1}, AggregateSum); n != 3 {
+		t.Fatalf("union: %d", n)
+	}
+	for key, expect := range map[string]float64{"x": 2, "y": 7, "z": 4} {
+		if score, _ := dst.Score(key); score != expect {
+			t.Fatalf("union score of %s: %v, expect %v", key, score, expect)
+		}
+	}
+	if dst.GetNode("old") != nil {
+		t.Fatal("dst not cleared")
+	}
+
+	//dst可以是参与计算的集合
+	if n, _ := InterStore(a, []*SortedSet[string, float64]{a, b}, nil, AggregateMax); n != 1 {
+		t.Fatalf("inter: %d", n)
+	}
+	if score, _ := a.Score("y"); score != 3 {
+		t.Fatalf("inter score: %v", score)
+	}
+	if _, err := UnionStore(dst, []*SortedSet[string, float64]{a, b}, []float64{1}, AggregateMin); err == nil {
+		t.Fatal("weights count mismatch accepted")
+	}
+	checkList(t, dst.list)
+}
+
+func (this *member) SetScore(score uint64) { this.score = score }
+
+func TestSetUpdate(t *testing.T) {
+	set := NewSet(memberCmp{})
+	for i := uint64(1); i <= 50; i++ {
+		set.Insert(&member{key: i, score: i * 10})
+	}
+	if set.Insert(&member{key: 1, score: 1000}) || set.Length() != 50 {
+		t.Fatal("duplicate key inserted")
+	}
+	if v := set.GetElement(1).(*member); v.score != 10 {
+		t.Fatalf("duplicate insert changed value: %d", v.score)
+	}
+
+	//排序不变，原地修改
+	x := set.GetNodeByRank(5)
+	if err := set.Update(5, 45); err != nil {
+		t.Fatal(err)
+	}
+	if set.GetNodeByRank(5) != x || set.GetRank(5) != 5 {
+		t.Fatalf("rank of 5: %d", set.GetRank(5))
+	}
+	if err := set.Update(5, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if set.GetRank(5) != 50 || set.GetNodeByRank(50) != x {
+		t.Fatalf("rank of 5: %d", set.GetRank(5))
+	}
+	if err := set.Update(51, 1); err == nil {
+		t.Fatal("update of missing key")
+	}
+	checkList(t, set.sl.List)
+}
+
+func TestSortedSetUpdate(t *testing.T) {
+	set := NewSortedSet[int, int]()
+	for i := 0; i < 200; i++ {
+		set.Insert(i, i)
+	}
+	nodes := make(map[int]*Node[int, int])
+	for i := 0; i < 200; i++ {
+		nodes[i] = set.GetNode(i)
+	}
+	for i := 0; i < 1000; i++ {
+		key, score := rand.Intn(200), rand.Intn(300)
+		if !set.Update(key, score) {
+			t.Fatalf("update %d", key)
+		}
+		if s, _ := set.Score(key); s != score || set.GetNode(key) != nodes[key] {
+			t.Fatalf("score of %d: %d, expect %d", key, s, score)
+		}
+	}
+	checkList(t, set.list)
+	if set.Update(200, 1) {
+		t.Fatal("update of missing key")
+	}
+}
+
+func TestSortedSetLex(t *testing.T) {
+	set := NewSortedSet[string, int]()
+	words := []string{"apple", "app", "application", "apply", "banana", "band", "bandana", "can"}
+	for _, w := range words {
+		set.Insert(w, 0)
+	}
+
+	//自动补全：以app开头
+	prefix := &LexRangeSpec[string]{Min: "app", Max: "app\xff"}
+	if ks := nodeKeys(set.GetRangeByLex(prefix, 0, -1)); !slices.Equal(ks, []string{"app", "apple", "application", "apply"}) {
+		t.Fatalf("prefix app: %v", ks)
+	}
+	if ks := nodeKeys(set.GetRangeByLex(prefix, 1, 2)); !slices.Equal(ks, []string{"apple", "application"}) {
+		t.Fatalf("prefix app limit: %v", ks)
+	}
+	if n := set.LexCount(prefix); n != 4 {
+		t.Fatalf("lex count: %d", n)
+	}
+
+	rg := &LexRangeSpec[string]{Min: "band", MinEx: true, MaxInf: true}
+	if ks := nodeKeys(set.GetRangeByLex(rg, 0, -1)); !slices.Equal(ks, []string{"bandana", "can"}) {
+		t.Fatalf("(band, +]: %v", ks)
+	}
+	rg = &LexRangeSpec[string]{MinInf: true, Max: "apple", MaxEx: true}
+	if x := set.LastInLexRange(rg); x == nil || x.Key() != "app" {
+		t.Fatalf("last in [-, apple): %v", x)
+	}
+	if set.FirstInLexRange(&LexRangeSpec[string]{Min: "d", MaxInf: true}) != nil {
+		t.Fatal("range after tail")
+	}
+	if set.LexCount(&LexRangeSpec[string]{Min: "b", Max: "a"}) != 0 {
+		t.Fatal("empty range counted")
+	}
+
+	if n := set.DeleteRangeByLex(&LexRangeSpec[string]{Min: "b", Max: "c"}); n != 3 {
+		t.Fatalf("delete range by lex: %d", n)
+	}
+	if set.Length() != 5 || set.GetNode("band") != nil {
+		t.Fatalf("length after delete: %d", set.Length())
+	}
+	checkList(t, set.list)
+}
+
+func TestSortedSetIter(t *testing.T) {
+	set := NewSortedSet[int, int]()
+	for i := 1; i <= 10; i++ {
+		set.Insert(i, i)
+	}
+	var ks []int
+	for k := range set.All() {
+		if k > 3 {
+			break
+		}
+		ks = append(ks, k)
+	}
+	if !slices.Equal(ks, []int{1, 2, 3}) {
+		t.Fatalf("all: %v", ks)
+	}
+	ks = ks[:0]
+	for k := range set.Backward() {
+		//遍历中删除当前元素
+		set.Delete(k)
+		if k%2 == 0 {
+			set.Insert(k, k)
+		}
+		ks = append(ks, k)
+	}
+	if !slices.Equal(ks, []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}) || set.Length() != 5 {
+		t.Fatalf("backward: %v, length %d", ks, set.Length())
+	}
+	ks = ks[:0]
+	for k := range set.FromRank(4) {
+		ks = append(ks, k)
+	}
+	if !slices.Equal(ks, []int{8, 10}) {
+		t.Fatalf("from rank: %v", ks)
+	}
+	ks = ks[:0]
+	for k, s := range set.ScoreRange(&Range[int]{Min: 3, Max: 8, MaxEx: true}) {
+		ks = append(ks, k)
+		set.Update(k, s+100)
+	}
+	if !slices.Equal(ks, []int{4, 6}) {
+		t.Fatalf("score range: %v", ks)
+	}
+	checkList(t, set.list)
+}
+
+func TestSortedSetScan(t *testing.T) {
+	set := NewSortedSet[int, int]()
+	for i := 1; i <= 10; i++ {
+		set.Insert(i, i*10)
+	}
+	var cur Cursor[int, int]
+	nodes, cur := set.Scan(cur, 3)
+	if ks := nodeKeys(nodes); !slices.Equal(ks, []int{1, 2, 3}) {
+		t.Fatalf("page 1: %v", ks)
+	}
+	//删除游标处的元素，在游标前后插入，移动游标后面的元素
+	set.Delete(3)
+	set.Insert(11, 5)
+	set.Insert(12, 35)
+	set.Update(5, 1000)
+	nodes, cur = set.Scan(cur, 3)
+	if ks := nodeKeys(nodes); !slices.Equal(ks, []int{12, 4, 6}) {
+		t.Fatalf("page 2: %v", ks)
+	}
+	nodes, cur = set.Scan(cur, 10)
+	if ks := nodeKeys(nodes); !slices.Equal(ks, []int{7, 8, 9, 10, 5}) {
+		t.Fatalf("page 3: %v", ks)
+	}
+	if nodes, _ = set.Scan(cur, 10); len(nodes) != 0 {
+		t.Fatalf("after end: %v", nodeKeys(nodes))
+	}
+}
+
+func TestSetIter(t *testing.T) {
+	set := NewSet(memberCmp{})
+	for i := uint64(1); i <= 10; i++ {
+		set.Insert(&member{key: i, score: i})
+	}
+	var ks []uint64
+	for v := range set.Backward() {
+		ks = append(ks, v.Key())
+		if len(ks) == 3 {
+			break
+		}
+	}
+	if !slices.Equal(ks, []uint64{10, 9, 8}) {
+		t.Fatalf("backward: %v", ks)
+	}
+	ks = ks[:0]
+	for v := range set.ScoreRange(&RangeSpec{Min: 2, Max: 4}) {
+		ks = append(ks, v.Key())
+	}
+	if !slices.Equal(ks, []uint64{2, 3, 4}) {
+		t.Fatalf("score range: %v", ks)
+	}
+	var n int
+	for range set.FromRank(9) {
+		n++
+	}
+	for range set.All() {
+		n++
+	}
+	if n != 12 {
+		t.Fatalf("from rank and all: %d", n)
+	}
+}
+
+func TestConcurrentSortedSet(t *testing.T) {
+	set := NewConcurrentSortedSet[int, int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := g*1000 + i
+				set.Insert(key, i)
+				if i%3 == 0 {
+					set.IncrBy(key, 7)
+				}
+				if i%5 == 0 {
+					set.Delete(key)
+				}
+			}
+			set.Batch(func(s *SortedSetFunc[int, int]) {
+				for i := 500; i < 600; i++ {
+					s.Insert(g*1000+i, i)
+				}
+			})
+		}(g)
+		go func() {
+			defer wg.Done()
+			var cur Cursor[int, int]
+			for i := 0; i < 500; i++ {
+				//排名和按排名取到的元素必须一致
+				set.View(func(s *SortedSetFunc[int, int]) {
+					if n := s.Length(); n > 0 {
+						rank := uint32(rand.Intn(int(n))) + 1
+						if x := s.GetNodeByRank(rank); s.GetRank(x.Key()) != rank {
+							t.Errorf("rank %d mismatch", rank)
+						}
+					}
+				})
+				set.GetRangeByRank(1, 10)
+				set.Count(&Range[int]{Min: 100, Max: 200})
+				_, cur = set.Scan(cur, 5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := set.Length(); n != 8*(500-100+100) {
+		t.Fatalf("length %d", n)
+	}
+	set.View(func(s *SortedSetFunc[int, int]) {
+		checkList(t, s.list)
+	})
+	last := -1
+	for _, m := range set.GetRangeByRank(1, set.Length()) {
+		if m.Score < last {
+			t.Fatalf("order broken at %d", m.Key)
+		}
+		last = m.Score
+	}
+}
+
+func TestSortedSetSnapshot(t *testing.T) {
+	set := NewSortedSet[string, float64]()
+	for i := 0; i < 1000; i++ {
+		set.Insert(strconv.Itoa(i), float64(rand.Intn(100))/4)
+	}
+	payload := func(key string) []byte { return []byte("p" + key) }
+
+	var buf bytes.Buffer
+	if err := set.EncodeBinary(&buf, payload); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewSortedSet[string, float64]()
+	var payloads int
+	err := loaded.DecodeBinary(&buf, func(key string, data []byte) {
+		if string(data) != "p"+key {
+			t.Fatalf("payload of %s: %s", key, data)
+		}
+		payloads++
+	})
+	if err != nil || payloads != 1000 {
+		t.Fatalf("decode: %v, %d payloads", err, payloads)
+	}
+	checkList(t, loaded.list)
+	if !reflect.DeepEqual(loaded.Records(nil), set.Records(nil)) {
+		t.Fatal("binary snapshot differs")
+	}
+	//装载的跳表可以继续正常修改
+	loaded.Insert("x", 1)
+	loaded.Update("1", 50)
+	loaded.DeleteRangeByRank(10, 20)
+	checkList(t, loaded.list)
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := NewSortedSet[string, float64]()
+	if err = json.Unmarshal(data, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON.Records(nil), set.Records(nil)) {
+		t.Fatal("json snapshot differs")
+	}
+	if err = fromJSON.UnmarshalJSON(data); err == nil {
+		t.Fatal("load into non-empty set")
+	}
+
+	if _, err = BulkLoad([]Member[int, int]{{1, 1}, {2, 1}, {1, 2}}); err == nil {
+		t.Fatal("duplicate key loaded")
+	}
+	if _, err = BulkLoad([]Member[int, int]{{1, 2}, {2, 1}}); err == nil {
+		t.Fatal("unsorted members loaded")
+	}
+	if err = NewSortedSet[int, int]().UnmarshalBinary([]byte("bad")); err == nil {
+		t.Fatal("bad snapshot decoded")
+	}
+}
+
+func TestSetSnapshot(t *testing.T) {
+	set := NewSet(memberCmp{})
+	for i := uint64(1); i <= 100; i++ {
+		set.Insert(&member{key: i, score: i % 7})
+	}
+	var buf bytes.Buffer
+	if err := set.EncodeBinary(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewSet(memberCmp{})
+	err := loaded.DecodeBinary(&buf, func(r Record[uint64, uint64]) Valuer {
+		return &member{key: r.Key, score: r.Score}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkList(t, loaded.sl.List)
+	if !reflect.DeepEqual(loaded.Records(nil), set.Records(nil)) || loaded.GetRank(7) != set.GetRank(7) {
+		t.Fatal("snapshot differs")
+	}
+}
+
+func TestConcurrentSortedSetSnapshot(t *testing.T) {
+	set := NewConcurrentSortedSet[int, int]()
+	for i := 0; i < 100; i++ {
+		set.Insert(i, i)
+	}
+	snap := set.Snapshot()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			set.Update(i, -i)
+			set.Insert(100+i, i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if snap.GetRank(i) != uint32(i+1) || snap.Length() != 100 {
+				t.Errorf("snapshot changed at %d", i)
+			}
+		}
+	}()
+	wg.Wait()
+	if set.Length() != 200 || set.GetRank(99) != 1 {
+		t.Fatalf("length %d, rank of 99 %d", set.Length(), set.GetRank(99))
+	}
+	checkList(t, snap.list)
+}
+
+func TestListOptions(t *testing.T) {
+	build := func(opts ...Option) *SortedSet[int, int] {
+		set := NewSortedSet[int, int](opts...)
+		for i := 0; i < 1000; i++ {
+			set.Insert(i, i%37)
+		}
+		if err := set.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return set
+	}
+	levels := func(set *SortedSet[int, int]) []int {
+		var ls []int
+		for x := set.First(); x != nil; x = x.Next(0) {
+			ls = append(ls, len(x.level))
+		}
+		return ls
+	}
+
+	//相同的种子得到相同的结构
+	if !slices.Equal(levels(build(WithSeed(1))), levels(build(WithSeed(1)))) {
+		t.Fatal("WithSeed not reproducible")
+	}
+	if !slices.Equal(levels(build(WithLCG(7))), levels(build(WithLCG(7)))) {
+		t.Fatal("WithLCG not reproducible")
+	}
+	if slices.Equal(levels(build(WithLCG(7))), levels(build(WithLCG(8)))) {
+		t.Fatal("different seeds, same structure")
+	}
+
+	set := build(WithMaxLevel(3), WithLCG(1))
+	if set.list.Level() > 3 || len(set.list.Head().level) > 3 {
+		t.Fatalf("level %d exceeds max level 3", set.list.Level())
+	}
+	//Clear和Clone保留选项
+	set.Clear()
+	if set.list.cfg.maxLevel != 3 || set.Clone().list.cfg.maxLevel != 3 {
+		t.Fatal("options lost")
+	}
+
+	//p越小层数越少
+	sum := func(ls []int) (n int) {
+		for _, l := range ls {
+			n += l
+		}
+		return
+	}
+	if low, high := sum(levels(build(WithP(0.1), WithSeed(2)))), sum(levels(build(WithP(0.5), WithSeed(2)))); low >= high {
+		t.Fatalf("levels with p=0.1: %d, p=0.5: %d", low, high)
+	}
+	set = build(WithRand(random.LCG), WithP(2))
+	if set.list.cfg.p != SKIPLIST_P {
+		t.Fatalf("invalid p accepted: %v", set.list.cfg.p)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	set := NewSortedSet[int, int](WithSeed(3))
+	for i := 0; i < 100; i++ {
+		set.Insert(i, i)
+	}
+	x := set.GetNodeByRank(50)
+	x.level[0].span++
+	if set.Validate() == nil {
+		t.Fatal("broken span not found")
+	}
+	x.level[0].span--
+	x.score = 1000
+	if set.Validate() == nil {
+		t.Fatal("broken order not found")
+	}
+	x.score = 49
+	delete(set.index, 49)
+	if set.Validate() == nil {
+		t.Fatal("broken index not found")
+	}
+}
+
+func FuzzSortedSet(f *testing.F) {
+	f.Add(int64(1), []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	f.Add(int64(2), []byte("insert delete update range"))
+	f.Fuzz(func(t *testing.T, seed int64, ops []byte) {
+		set := NewSortedSet[byte, byte](WithSeed(seed), WithMaxLevel(int(seed%8)+1))
+		for i := 0; i+1 < len(ops); i += 2 {
+			key, score := ops[i]%64, ops[i+1]
+			switch ops[i] % 5 {
+			case 0, 1:
+				set.Insert(key, score)
+			case 2:
+				set.Update(key, score)
+			case 3:
+				set.Delete(key)
+			case 4:
+				set.DeleteRangeByRank(uint32(score%8)+1, uint32(score%8)+3)
+			}
+			if err := set.Validate(); err != nil {
+				t.Fatalf("after op %d: %v", i/2, err)
+			}
+		}
+	})
+}
+
+// withSeparateLevels 使用旧的节点布局（层数组单独分配），用于对比。
+func withSeparateLevels() Option {
+	return func(cfg *config) {
+		cfg.separate = true
+	}
+}
+
+func TestNodeLayout(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"inline":   nil,
+		"separate": {withSeparateLevels()},
+		"arena":    {WithArena()},
+		"freelist": {WithFreeList()},
+		"both":     {WithArena(), WithFreeList(), WithP(0.5)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			set := NewSortedSet[int, int](append(opts, WithSeed(5))...)
+			ref := make(map[int]int)
+			for i := 0; i < 20000; i++ {
+				key, score := rand.Intn(2000), rand.Intn(500)
+				switch i % 4 {
+				case 0, 1:
+					if set.Insert(key, score) {
+						ref[key] = score
+					}
+				case 2:
+					if set.Update(key, score) {
+						ref[key] = score
+					}
+				case 3:
+					for _, x := range set.PopMin(1) {
+						delete(ref, x.Key())
+					}
+					if set.Delete(key) {
+						delete(ref, key)
+					}
+				}
+			}
+			if err := set.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if int(set.Length()) != len(ref) {
+				t.Fatalf("length %d, expect %d", set.Length(), len(ref))
+			}
+			for key, score := range ref {
+				if s, _ := set.Score(key); s != score {
+					t.Fatalf("score of %d: %d, expect %d", key, s, score)
+				}
+			}
+		})
+	}
+
+	//删除的节点被复用
+	set := NewSortedSet[int, int](WithFreeList())
+	set.Insert(1, 1)
+	x := set.GetNode(1)
+	set.Delete(1)
+	for i := 0; i < 100 && set.GetNode(2+i) != x; i++ {
+		set.Insert(2+i, i)
+		set.Delete(2 + i)
+		set.Insert(2+i, i)
+	}
+	if err := set.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var reused bool
+	for x2 := set.First(); x2 != nil; x2 = x2.Next(0) {
+		reused = reused || x2 == x
+	}
+	if !reused {
+		t.Fatal("deleted node not reused")
+	}
+}
+
+var layouts = []struct {
+	name string
+	opts []Option
+}{
+	{"separate", []Option{withSeparateLevels()}},
+	{"inline", nil},
+	{"arena", []Option{WithArena()}},
+	{"arena+freelist", []Option{WithArena(), WithFreeList()}},
+}
+
+// BenchmarkInsert 比较各种节点布局每次插入的分配次数和字节数。
+func BenchmarkInsert(b *testing.B) {
+	for _, layout := range layouts {
+		b.Run(layout.name, func(b *testing.B) {
+			l := NewList(cmp.Compare[int], cmp.Compare[int], append(layout.opts, WithLCG(1))...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.Insert(i, i)
+			}
+		})
+	}
+	b.Run("SkipList", func(b *testing.B) {
+		sl := NewSkipList(memberCmp{}, WithLCG(1))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sl.Insert(&member{key: uint64(i), score: uint64(i)})
+		}
+	})
+}
+
+// BenchmarkChurn 比较删除再插入时的分配，WithFreeList时不再分配。
+func BenchmarkChurn(b *testing.B) {
+	for _, layout := range layouts {
+		b.Run(layout.name, func(b *testing.B) {
+			l := NewList(cmp.Compare[int], cmp.Compare[int], append(layout.opts, WithLCG(1))...)
+			for i := 0; i < 10000; i++ {
+				l.Insert(i, i)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := i % 10000
+				l.Delete(key, key)
+				l.Insert(key, key)
+			}
+		})
+	}
+}
+
+// BenchmarkMemory 报告每个元素占用的堆内存。
+func BenchmarkMemory(b *testing.B) {
+	const n = 100000
+	heap := func() uint64 {
+		var ms runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc
+	}
+	for _, layout := range layouts {
+		b.Run(layout.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				before := heap()
+				l := NewList(cmp.Compare[int], cmp.Compare[int], append(layout.opts, WithLCG(1))...)
+				for j := 0; j < n; j++ {
+					l.Insert(j, j)
+				}
+				b.ReportMetric(float64(heap()-before)/n, "B/elem")
+				runtime.KeepAlive(l)
+			}
+		})
+	}
+}
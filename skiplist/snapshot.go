@@ -0,0 +1,364 @@
+package skiplist
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// 快照格式：
+//   二进制：magic "SKSS"，版本，flags（1表示带payload），元素个数，然后按排名依次是key、score、payload。
+//   字符串、整数、浮点数、bool按类型变长编码，其他定长类型（如定长结构体）用encoding/binary小端编码。
+//   JSON：按排名排列的Record数组。
+// 快照按排名保存，读取时用Load在O(n)内建好跳表。
+
+var snapshotMagic = []byte("SKSS")
+
+const (
+	snapshotVersion     byte = 1
+	snapshotFlagPayload byte = 1
+	snapshotMaxBytes         = 1 << 30 //单个字符串或payload的最大长度
+)
+
+// Record 是快照中的一个元素，Payload是调用者附带的数据，可以为空。
+type Record[K, S any] struct {
+	Key     K      `json:"key"`
+	Score   S      `json:"score"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// appendSorted 把已经排好序的(key, score)依次接到表尾，O(n)建表。调用者保证list为空且输入有序。
+func (this *List[K, S]) appendSorted(next func() (K, S, bool)) {
+	var update [SKIPLIST_MAXLEVEL]*Node[K, S]
+	var rank [SKIPLIST_MAXLEVEL]uint32
+	for i := range update {
+		update[i] = this.head
+	}
+	for key, score, ok := next(); ok; key, score, ok = next() {
+		x := this.alloc.alloc(this.randomLevel(), key, score)
+		this.growHead(len(x.level))
+		this.length++
+		for i := range x.level {
+			update[i].SetNext(i, x)
+			update[i].SetSpan(i, this.length-rank[i])
+			update[i], rank[i] = x, this.length
+		}
+		if len(x.level) > int(this.level) {
+			this.level = uint32(len(x.level))
+		}
+		if this.tail != nil {
+			x.backward = this.tail
+		}
+		this.tail = x
+	}
+	for i := 0; i < int(this.level); i++ {
+		update[i].SetSpan(i, this.length-rank[i])
+	}
+}
+
+// Load 用排好序的元素（按排名，key不重复）在O(n)内建表，集合必须是空的。
+func (this *SortedSetFunc[K, S]) Load(members []Member[K, S]) error {
+	if this.Length() != 0 {
+		return fmt.Errorf("load into non-empty set")
+	}
+	for i := 1; i < len(members); i++ {
+		a, b := members[i-1], members[i]
+		c := this.list.cmpScore(a.Score, b.Score)
+		if c == 0 {
+			c = this.list.cmpKey(a.Key, b.Key)
+		}
+		if c >= 0 {
+			return fmt.Errorf("members not sorted or duplicated at %d", i)
+		}
+	}
+	for _, m := range members {
+		if _, exist := this.index[m.Key]; exist {
+			this.Clear()
+			return fmt.Errorf("duplicate key %v", m.Key)
+		}
+		this.index[m.Key] = nil
+	}
+
+	i := 0
+	this.list.appendSorted(func() (K, S, bool) {
+		if i == len(members) {
+			var key K
+			var score S
+			return key, score, false
+		}
+		m := members[i]
+		i++
+		return m.Key, m.Score, true
+	})
+	for x := this.list.First(); x != nil; x = x.Next(0) {
+		this.index[x.key] = x
+	}
+	return nil
+}
+
+// BulkLoad 用排好序的元素在O(n)内创建集合，见Load。
+func BulkLoad[K cmp.Ordered, S cmp.Ordered](members []Member[K, S], opts ...Option) (*SortedSet[K, S], error) {
+	set := NewSortedSet[K, S](opts...)
+	if err := set.Load(members); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Clone 在O(n)内复制集合。
+func (this *SortedSetFunc[K, S]) Clone() *SortedSetFunc[K, S] {
+	clone := &SortedSetFunc[K, S]{
+		list:  this.list.empty(),
+		index: make(map[K]*Node[K, S], this.Length()),
+		add:   this.add,
+	}
+	x := this.list.First()
+	clone.list.appendSorted(func() (K, S, bool) {
+		if x == nil {
+			var key K
+			var score S
+			return key, score, false
+		}
+		key, score := x.key, x.score
+		x = x.Next(0)
+		return key, score, true
+	})
+	for x := clone.list.First(); x != nil; x = x.Next(0) {
+		clone.index[x.key] = x
+	}
+	return clone
+}
+
+// Records 按排名返回所有元素，payload不为nil时用它取每个元素附带的数据。
+func (this *SortedSetFunc[K, S]) Records(payload func(key K) []byte) []Record[K, S] {
+	records := make([]Record[K, S], 0, this.Length())
+	for x := this.First(); x != nil; x = x.Next(0) {
+		r := Record[K, S]{Key: x.key, Score: x.score}
+		if payload != nil {
+			r.Payload = payload(x.key)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// LoadRecords 同Load，payload不为nil时对每个元素调用一次。
+func (this *SortedSetFunc[K, S]) LoadRecords(records []Record[K, S], payload func(key K, data []byte)) error {
+	members := make([]Member[K, S], 0, len(records))
+	for _, r := range records {
+		members = append(members, Member[K, S]{Key: r.Key, Score: r.Score})
+	}
+	if err := this.Load(members); err != nil {
+		return err
+	}
+	if payload != nil {
+		for _, r := range records {
+			payload(r.Key, r.Payload)
+		}
+	}
+	return nil
+}
+
+func (this *SortedSetFunc[K, S]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.Records(nil))
+}
+
+// UnmarshalJSON 把JSON快照读到空集合中，集合要先用构造函数创建好。
+func (this *SortedSetFunc[K, S]) UnmarshalJSON(data []byte) error {
+	var records []Record[K, S]
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	return this.LoadRecords(records, nil)
+}
+
+// EncodeBinary 把集合按二进制格式写到w，payload不为nil时同时写入每个元素附带的数据。
+func (this *SortedSetFunc[K, S]) EncodeBinary(w io.Writer, payload func(key K) []byte) error {
+	return writeRecords(w, this.Records(payload), payload != nil)
+}
+
+// DecodeBinary 从r读取EncodeBinary写的快照到空集合中，快照带payload且payload不为nil时对每个元素调用一次。
+func (this *SortedSetFunc[K, S]) DecodeBinary(r io.Reader, payload func(key K, data []byte)) error {
+	records, err := readRecords[K, S](r)
+	if err != nil {
+		return err
+	}
+	return this.LoadRecords(records, payload)
+}
+
+func writeRecords[K, S any](w io.Writer, records []Record[K, S], withPayload bool) error {
+	buf := append([]byte{}, snapshotMagic...)
+	var flags byte
+	if withPayload {
+		flags |= snapshotFlagPayload
+	}
+	buf = append(buf, snapshotVersion, flags)
+	buf = binary.AppendUvarint(buf, uint64(len(records)))
+
+	var err error
+	for _, r := range records {
+		if buf, err = appendValue(buf, r.Key); err != nil {
+			return err
+		}
+		if buf, err = appendValue(buf, r.Score); err != nil {
+			return err
+		}
+		if withPayload {
+			buf = binary.AppendUvarint(buf, uint64(len(r.Payload)))
+			buf = append(buf, r.Payload...)
+		}
+		if len(buf) >= 4096 {
+			if _, err = w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func readRecords[K, S any](r io.Reader) ([]Record[K, S], error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic) {
+		return nil, fmt.Errorf("not a skiplist snapshot")
+	}
+	if v := header[len(snapshotMagic)]; v != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", v)
+	}
+	flags := header[len(snapshotMagic)+1]
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record[K, S], 0, min(n, 1<<16))
+	for i := uint64(0); i < n; i++ {
+		var rec Record[K, S]
+		if err = readValue(br, &rec.Key); err != nil {
+			return nil, err
+		}
+		if err = readValue(br, &rec.Score); err != nil {
+			return nil, err
+		}
+		if flags&snapshotFlagPayload != 0 {
+			if rec.Payload, err = readBytes(br); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func (this *SortedSetFunc[K, S]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := this.EncodeBinary(&buf, nil)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary 把二进制快照读到空集合中，集合要先用构造函数创建好。
+func (this *SortedSetFunc[K, S]) UnmarshalBinary(data []byte) error {
+	return this.DecodeBinary(bytes.NewReader(data), nil)
+}
+
+func appendValue(buf []byte, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		buf = binary.AppendUvarint(buf, uint64(rv.Len()))
+		return append(buf, rv.String()...), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(buf, rv.Uint()), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(rv.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(rv.Float())), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	}
+	return binary.Append(buf, binary.LittleEndian, v)
+}
+
+func readValue(r *bufio.Reader, p any) error {
+	rv := reflect.ValueOf(p).Elem()
+	switch rv.Kind() {
+	case reflect.String:
+		data, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+		rv.SetString(string(data))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowInt(v) {
+			return fmt.Errorf("value %d overflows %v", v, rv.Type())
+		}
+		rv.SetInt(v)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowUint(v) {
+			return fmt.Errorf("value %d overflows %v", v, rv.Type())
+		}
+		rv.SetUint(v)
+		return nil
+	case reflect.Float32:
+		var v uint32
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return err
+		}
+		rv.SetFloat(float64(math.Float32frombits(v)))
+		return nil
+	case reflect.Float64:
+		var v uint64
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return err
+		}
+		rv.SetFloat(math.Float64frombits(v))
+		return nil
+	case reflect.Bool:
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b != 0)
+		return nil
+	}
+	return binary.Read(r, binary.LittleEndian, p)
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > snapshotMaxBytes {
+		return nil, fmt.Errorf("length %d too large", n)
+	}
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
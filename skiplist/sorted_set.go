@@ -0,0 +1,234 @@
+package skiplist
+
+import "cmp"
+
+// SortedSetFunc 是类型安全的有序集合（同Redis的zset）：key唯一，按score排序，
+// score相同的按key排序。排序由构造时传入的比较函数决定。
+type SortedSetFunc[K comparable, S any] struct {
+	list  *List[K, S]
+	index map[K]*Node[K, S]
+	add   func(a, b S) S
+}
+
+func NewSortedSetFunc[K comparable, S any](cmpKey func(a, b K) int, cmpScore func(a, b S) int, opts ...Option) *SortedSetFunc[K, S] {
+	return &SortedSetFunc[K, S]{
+		list:  NewList(cmpKey, cmpScore, opts...),
+		index: make(map[K]*Node[K, S]),
+	}
+}
+
+// SortedSet 是score可以直接比较大小的有序集合，按score从小到大排序。
+type SortedSet[K comparable, S cmp.Ordered] struct {
+	*SortedSetFunc[K, S]
+}
+
+func NewSortedSet[K cmp.Ordered, S cmp.Ordered](opts ...Option) *SortedSet[K, S] {
+	set := NewSortedSetFunc(cmp.Compare[K], cmp.Compare[S], opts...)
+	set.add = func(a, b S) S { return a + b }
+	return &SortedSet[K, S]{SortedSetFunc: set}
+}
+
+func (this *SortedSetFunc[K, S]) Length() uint32 { return this.list.Length() }
+
+func (this *SortedSetFunc[K, S]) Head() *Node[K, S] { return this.list.Head() }
+
+func (this *SortedSetFunc[K, S]) Tail() *Node[K, S] { return this.list.Tail() }
+
+func (this *SortedSetFunc[K, S]) First() *Node[K, S] { return this.list.First() }
+
+// Insert 插入key，key已经存在时不插入并返回false。
+func (this *SortedSetFunc[K, S]) Insert(key K, score S) bool {
+	if _, exist := this.index[key]; exist {
+		return false
+	}
+	this.index[key] = this.list.Insert(key, score)
+	return true
+}
+
+// Update 把key的score改为score，key不存在时返回false。
+func (this *SortedSetFunc[K, S]) Update(key K, score S) bool {
+	x, exist := this.index[key]
+	if !exist {
+		return false
+	}
+	this.list.UpdateScore(key, x.score, score)
+	return true
+}
+
+// Score 返回key的score。
+func (this *SortedSetFunc[K, S]) Score(key K) (S, bool) {
+	if x, exist := this.index[key]; exist {
+		return x.score, true
+	}
+	var score S
+	return score, false
+}
+
+func (this *SortedSetFunc[K, S]) GetNode(key K) *Node[K, S] {
+	return this.index[key]
+}
+
+func (this *SortedSetFunc[K, S]) Delete(key K) bool {
+	x, exist := this.index[key]
+	if !exist {
+		return false
+	}
+	delete(this.index, key)
+	this.list.Delete(key, x.score)
+	return true
+}
+
+// GetRank 返回key的排名，从1开始，不存在时返回0。
+func (this *SortedSetFunc[K, S]) GetRank(key K) uint32 {
+	if x, exist := this.index[key]; exist {
+		return this.list.GetRank(key, x.score)
+	}
+	return 0
+}
+
+// GetNodeByRank 返回排名为rank的节点，排名从1开始。
+func (this *SortedSetFunc[K, S]) GetNodeByRank(rank uint32) *Node[K, S] {
+	return this.list.GetNodeByRank(rank)
+}
+
+// DeleteRangeByRank 删除排名在[start, end]之间的元素，返回删除的个数。
+func (this *SortedSetFunc[K, S]) DeleteRangeByRank(start, end uint32) uint32 {
+	return this.list.DeleteRangeByRank(start, end, func(x *Node[K, S]) {
+		delete(this.index, x.key)
+	})
+}
+
+// GetRangeByRank 返回排名在[start, end]之间的节点，end超过长度时取到最后。
+func (this *SortedSetFunc[K, S]) GetRangeByRank(start, end uint32) []*Node[K, S] {
+	if start == 0 || end < start || start > this.Length() {
+		return nil
+	}
+	if end > this.Length() {
+		end = this.Length()
+	}
+	nodes := make([]*Node[K, S], 0, end-start+1)
+	for x := this.list.GetNodeByRank(start); x != nil && start <= end; x, start = x.Next(0), start+1 {
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// Range 是score的区间，MinEx、MaxEx表示不包含边界。
+type Range[S any] struct {
+	MinEx, MaxEx bool
+	Min, Max     S
+}
+
+func (this *SortedSetFunc[K, S]) gteMin(score S, rg *Range[S]) bool {
+	if rg.MinEx {
+		return this.list.cmpScore(score, rg.Min) > 0
+	}
+	return this.list.cmpScore(score, rg.Min) >= 0
+}
+
+func (this *SortedSetFunc[K, S]) lteMax(score S, rg *Range[S]) bool {
+	if rg.MaxEx {
+		return this.list.cmpScore(score, rg.Max) < 0
+	}
+	return this.list.cmpScore(score, rg.Max) <= 0
+}
+
+// IsInRange 判断集合里是否可能有元素在rg中。
+func (this *SortedSetFunc[K, S]) IsInRange(rg *Range[S]) bool {
+	c := this.list.cmpScore(rg.Min, rg.Max)
+	if c > 0 || (c == 0 && (rg.MinEx || rg.MaxEx)) {
+		return false
+	}
+
+	x := this.list.Tail()
+	if x == nil || !this.gteMin(x.score, rg) {
+		return false
+	}
+
+	x = this.list.First()
+	if x == nil || !this.lteMax(x.score, rg) {
+		return false
+	}
+	return true
+}
+
+// FirstInRange 返回rg中的第一个节点，没有时返回nil。
+func (this *SortedSetFunc[K, S]) FirstInRange(rg *Range[S]) *Node[K, S] {
+	if !this.IsInRange(rg) {
+		return nil
+	}
+
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && !this.gteMin(next.score, rg); next = x.Next(i) {
+			x = next
+		}
+	}
+	x = x.Next(0)
+	if !this.lteMax(x.score, rg) {
+		return nil
+	}
+	return x
+}
+
+// LastInRange 返回rg中的最后一个节点，没有时返回nil。
+func (this *SortedSetFunc[K, S]) LastInRange(rg *Range[S]) *Node[K, S] {
+	if !this.IsInRange(rg) {
+		return nil
+	}
+
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && this.lteMax(next.score, rg); next = x.Next(i) {
+			x = next
+		}
+	}
+	if !this.gteMin(x.score, rg) {
+		return nil
+	}
+	return x
+}
+
+// DeleteRangeByScore 删除score在rg中的元素，返回删除的个数。
+func (this *SortedSetFunc[K, S]) DeleteRangeByScore(rg *Range[S]) uint32 {
+	update := make([]*Node[K, S], int(this.list.Level()))
+	var removed uint32 = 0
+	x := this.list.Head()
+	for i := int(this.list.Level() - 1); i >= 0; i-- {
+		for next := x.Next(i); next != nil && !this.gteMin(next.score, rg); next = x.Next(i) {
+			x = next
+		}
+		update[i] = x
+	}
+	x = x.Next(0)
+	for x != nil && this.lteMax(x.score, rg) {
+		next := x.Next(0)
+		this.list.DeleteNode(x, update)
+		delete(this.index, x.key)
+		removed++
+		x = next
+	}
+	return removed
+}
+
+// GetRangeByScore 返回score在rg中的节点。
+func (this *SortedSetFunc[K, S]) GetRangeByScore(rg *Range[S]) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	for x := this.FirstInRange(rg); x != nil && this.lteMax(x.score, rg); x = x.Next(0) {
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// Range 从小到大遍历所有元素，f返回false时停止。
+func (this *SortedSetFunc[K, S]) Range(f func(key K, score S) bool) {
+	for x := this.First(); x != nil; x = x.Next(0) {
+		if !f(x.key, x.score) {
+			return
+		}
+	}
+}
+
+func (this *SortedSetFunc[K, S]) Dump() {
+	this.list.Dump()
+}
@@ -0,0 +1,91 @@
+package skiplist
+
+import "fmt"
+
+// Validate 检查跳表的结构：后退指针、顺序、长度、尾节点、层数和各层的跨度，
+// 用于测试和fuzz，复杂度O(n*level)。
+func (this *List[K, S]) Validate() error {
+	if this.level < 1 || int(this.level) > len(this.head.level) {
+		return fmt.Errorf("level %d out of [1, %d]", this.level, len(this.head.level))
+	}
+	if this.level > 1 && this.head.Next(int(this.level-1)) == nil {
+		return fmt.Errorf("top level %d is empty", this.level)
+	}
+	for i := int(this.level); i < len(this.head.level); i++ {
+		if this.head.Next(i) != nil {
+			return fmt.Errorf("level %d above list level %d is used", i, this.level)
+		}
+	}
+
+	ranks := make(map[*Node[K, S]]uint32, this.length)
+	var rank uint32
+	var prev *Node[K, S]
+	for x := this.First(); x != nil; x = x.Next(0) {
+		rank++
+		ranks[x] = rank
+		if x.Prev() != prev {
+			return fmt.Errorf("backward of rank %d broken", rank)
+		}
+		if prev != nil && this.compare(prev, x.key, x.score) >= 0 {
+			return fmt.Errorf("order broken at rank %d", rank)
+		}
+		if len(x.level) > int(this.level) {
+			return fmt.Errorf("node of rank %d has %d levels, list level %d", rank, len(x.level), this.level)
+		}
+		prev = x
+	}
+	if rank != this.length {
+		return fmt.Errorf("length %d, counted %d", this.length, rank)
+	}
+	if this.tail != prev {
+		return fmt.Errorf("tail is not the last node")
+	}
+
+	for i := 0; i < int(this.level); i++ {
+		var r uint32
+		for x := this.head; x.Next(i) != nil; x = x.Next(i) {
+			next := x.Next(i)
+			nr, exist := ranks[next]
+			if !exist {
+				return fmt.Errorf("node at level %d not in level 0", i)
+			}
+			if r+x.Span(i) != nr {
+				return fmt.Errorf("span broken at level %d rank %d", i, nr)
+			}
+			r = nr
+		}
+	}
+	return nil
+}
+
+// Validate 检查跳表的结构以及索引和跳表是否一致。
+func (this *SortedSetFunc[K, S]) Validate() error {
+	if err := this.list.Validate(); err != nil {
+		return err
+	}
+	if len(this.index) != int(this.Length()) {
+		return fmt.Errorf("index has %d keys, list length %d", len(this.index), this.Length())
+	}
+	for x := this.First(); x != nil; x = x.Next(0) {
+		if this.index[x.key] != x {
+			return fmt.Errorf("index of %v broken", x.key)
+		}
+	}
+	return nil
+}
+
+// Validate 检查跳表的结构以及索引和跳表是否一致。
+func (this *Set) Validate() error {
+	if err := this.sl.Validate(); err != nil {
+		return err
+	}
+	if len(this.index) != int(this.Length()) {
+		return fmt.Errorf("index has %d keys, list length %d", len(this.index), this.Length())
+	}
+	for v := range this.All() {
+		if this.index[v.Key()] != v {
+			return fmt.Errorf("index of %d broken", v.Key())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package skiplist
+
+import "fmt"
+
+// 仿照Redis zset命令的接口，排名都从1开始。
+
+// AddFlag 是Add的选项，对应ZADD的NX、XX、GT、LT、INCR，可以组合使用。
+type AddFlag int
+
+const (
+	AddNX   AddFlag = 1 << iota //只添加新元素，不更新已有的
+	AddXX                       //只更新已有的元素，不添加
+	AddGT                       //只在新score更大时更新，不影响添加
+	AddLT                       //只在新score更小时更新，不影响添加
+	AddIncr                     //把score加到原来的score上，同ZINCRBY
+)
+
+// SetAddFunc 设置score的加法，用于AddIncr、IncrBy。NewSortedSet创建的集合已经设置。
+func (this *SortedSetFunc[K, S]) SetAddFunc(add func(a, b S) S) {
+	this.add = add
+}
+
+// Add 添加或更新key，返回操作后的score以及是否添加或更新了。
+// 因NX、XX、GT、LT没有执行时返回原来的score（不存在时为零值）和false。
+func (this *SortedSetFunc[K, S]) Add(key K, score S, flags AddFlag) (S, bool, error) {
+	if flags&AddNX != 0 && flags&(AddXX|AddGT|AddLT) != 0 {
+		return score, false, fmt.Errorf("NX is not compatible with XX, GT or LT")
+	}
+	if flags&AddGT != 0 && flags&AddLT != 0 {
+		return score, false, fmt.Errorf("GT and LT are not compatible")
+	}
+	if flags&AddIncr != 0 && this.add == nil {
+		return score, false, fmt.Errorf("add func not set")
+	}
+
+	x, exist := this.index[key]
+	if !exist {
+		if flags&AddXX != 0 {
+			return score, false, nil
+		}
+		this.index[key] = this.list.Insert(key, score)
+		return score, true, nil
+	}
+
+	if flags&AddNX != 0 {
+		return x.score, false, nil
+	}
+	if flags&AddIncr != 0 {
+		score = this.add(x.score, score)
+	}
+	c := this.list.cmpScore(score, x.score)
+	if c == 0 || (flags&AddGT != 0 && c < 0) || (flags&AddLT != 0 && c > 0) {
+		return x.score, false, nil
+	}
+	this.list.UpdateScore(key, x.score, score)
+	return score, true, nil
+}
+
+// IncrBy 把key的score加上delta，key不存在时以delta添加，同ZINCRBY。
+func (this *SortedSetFunc[K, S]) IncrBy(key K, delta S) (S, error) {
+	score, _, err := this.Add(key, delta, AddIncr)
+	return score, err
+}
+
+// GetRevRank 返回key从大到小的排名，从1开始，不存在时返回0，同ZREVRANK。
+func (this *SortedSetFunc[K, S]) GetRevRank(key K) uint32 {
+	if rank := this.GetRank(key); rank > 0 {
+		return this.Length() - rank + 1
+	}
+	return 0
+}
+
+// GetRevRangeByRank 返回从大到小排名在[start, end]之间的节点，同ZREVRANGE。
+func (this *SortedSetFunc[K, S]) GetRevRangeByRank(start, end uint32) []*Node[K, S] {
+	if start == 0 || end < start || start > this.Length() {
+		return nil
+	}
+	if end > this.Length() {
+		end = this.Length()
+	}
+	nodes := make([]*Node[K, S], 0, end-start+1)
+	x := this.list.GetNodeByRank(this.Length() - start + 1)
+	for ; x != nil && start <= end; x, start = x.Prev(), start+1 {
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// GetRangeByScoreLimit 返回score在rg中的节点，跳过前offset个，最多返回count个，
+// count<0表示不限，同ZRANGEBYSCORE ... LIMIT offset count。
+func (this *SortedSetFunc[K, S]) GetRangeByScoreLimit(rg *Range[S], offset, count int) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	x := this.FirstInRange(rg)
+	if x != nil && offset > 0 {
+		x = this.list.GetNodeByRank(this.list.GetRank(x.key, x.score) + uint32(offset))
+	}
+	for ; x != nil && count != 0 && this.lteMax(x.score, rg); x = x.Next(0) {
+		nodes = append(nodes, x)
+		count--
+	}
+	return nodes
+}
+
+// GetRevRangeByScore 从大到小返回score在rg中的节点，offset、count同GetRangeByScoreLimit，
+// 同ZREVRANGEBYSCORE。
+func (this *SortedSetFunc[K, S]) GetRevRangeByScore(rg *Range[S], offset, count int) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	x := this.LastInRange(rg)
+	if x != nil && offset > 0 {
+		rank := this.list.GetRank(x.key, x.score)
+		if uint32(offset) >= rank {
+			return nil
+		}
+		x = this.list.GetNodeByRank(rank - uint32(offset))
+	}
+	for ; x != nil && count != 0 && this.gteMin(x.score, rg); x = x.Prev() {
+		nodes = append(nodes, x)
+		count--
+	}
+	return nodes
+}
+
+// Count 返回score在rg中的元素个数，同ZCOUNT。
+func (this *SortedSetFunc[K, S]) Count(rg *Range[S]) uint32 {
+	first := this.FirstInRange(rg)
+	if first == nil {
+		return 0
+	}
+	last := this.LastInRange(rg)
+	return this.list.GetRank(last.key, last.score) - this.list.GetRank(first.key, first.score) + 1
+}
+
+// PopMin 删除并返回score最小的count个元素，同ZPOPMIN。
+func (this *SortedSetFunc[K, S]) PopMin(count int) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	for ; count > 0 && this.First() != nil; count-- {
+		x := this.First()
+		this.Delete(x.key)
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// PopMax 删除并返回score最大的count个元素，同ZPOPMAX。
+func (this *SortedSetFunc[K, S]) PopMax(count int) []*Node[K, S] {
+	var nodes []*Node[K, S]
+	for ; count > 0 && this.Tail() != nil; count-- {
+		x := this.Tail()
+		this.Delete(x.key)
+		nodes = append(nodes, x)
+	}
+	return nodes
+}
+
+// Clear 删除所有元素。
+func (this *SortedSetFunc[K, S]) Clear() {
+	this.list = this.list.empty()
+	this.index = make(map[K]*Node[K, S])
+}
+
+// Number 是可以做加权聚合的score类型。
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Aggregate 决定UnionStore、InterStore中同一个key的score如何合并。
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+func aggregate[S Number](agg Aggregate, a, b S) S {
+	switch agg {
+	case AggregateMin:
+		return min(a, b)
+	case AggregateMax:
+		return max(a, b)
+	}
+	return a + b
+}
+
+// UnionStore 把sets的并集存到dst（dst原来的内容被清空，dst可以是sets之一），
+// 每个集合的score先乘以对应的weights（为nil时都是1），返回dst的长度，同ZUNIONSTORE。
+func UnionStore[K comparable, S Number](dst *SortedSet[K, S], sets []*SortedSet[K, S],
+	weights []S, agg Aggregate) (uint32, error) {
+	return store(dst, sets, weights, agg, false)
+}
+
+// InterStore 同UnionStore，但只保留所有集合中都有的key，同ZINTERSTORE。
+func InterStore[K comparable, S Number](dst *SortedSet[K, S], sets []*SortedSet[K, S],
+	weights []S, agg Aggregate) (uint32, error) {
+	return store(dst, sets, weights, agg, true)
+}
+
+func store[K comparable, S Number](dst *SortedSet[K, S], sets []*SortedSet[K, S],
+	weights []S, agg Aggregate, inter bool) (uint32, error) {
+	if weights != nil && len(weights) != len(sets) {
+		return 0, fmt.Errorf("weights count %d not match sets count %d", len(weights), len(sets))
+	}
+
+	scores := make(map[K]S)
+	counts := make(map[K]int)
+	for i, set := range sets {
+		var weight S = 1
+		if weights != nil {
+			weight = weights[i]
+		}
+		for x := set.First(); x != nil; x = x.Next(0) {
+			score := x.score * weight
+			if old, exist := scores[x.key]; exist {
+				score = aggregate(agg, old, score)
+			}
+			scores[x.key] = score
+			counts[x.key]++
+		}
+	}
+
+	dst.Clear()
+	for key, score := range scores {
+		if inter && counts[key] != len(sets) {
+			continue
+		}
+		dst.Insert(key, score)
+	}
+	return dst.Length(), nil
+}